@@ -0,0 +1,39 @@
+package cwlogger
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+)
+
+// CloudWatchLogsAPI is the subset of the CloudWatch Logs API used by the
+// Logger. It is implemented by *cloudwatchlogs.Client, and can be implemented
+// by mocks in tests.
+type CloudWatchLogsAPI interface {
+	CreateLogGroup(ctx context.Context, params *cloudwatchlogs.CreateLogGroupInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogGroupOutput, error)
+	PutRetentionPolicy(ctx context.Context, params *cloudwatchlogs.PutRetentionPolicyInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutRetentionPolicyOutput, error)
+	DescribeLogGroups(ctx context.Context, params *cloudwatchlogs.DescribeLogGroupsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DescribeLogGroupsOutput, error)
+	CreateLogStream(ctx context.Context, params *cloudwatchlogs.CreateLogStreamInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogStreamOutput, error)
+	DescribeLogStreams(ctx context.Context, params *cloudwatchlogs.DescribeLogStreamsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DescribeLogStreamsOutput, error)
+	PutLogEvents(ctx context.Context, params *cloudwatchlogs.PutLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutLogEventsOutput, error)
+}
+
+// LogGroupDeleter is implemented by clients that can delete log groups, as
+// required by Logger.DeleteLogGroup. It is implemented by
+// *cloudwatchlogs.Client.
+type LogGroupDeleter interface {
+	DeleteLogGroup(ctx context.Context, params *cloudwatchlogs.DeleteLogGroupInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DeleteLogGroupOutput, error)
+}
+
+// LogStreamDeleter is implemented by clients that can delete log streams, as
+// required by the CleanupEmptyStreams option. It is implemented by
+// *cloudwatchlogs.Client.
+type LogStreamDeleter interface {
+	DeleteLogStream(ctx context.Context, params *cloudwatchlogs.DeleteLogStreamInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DeleteLogStreamOutput, error)
+}
+
+var (
+	_ CloudWatchLogsAPI = (*cloudwatchlogs.Client)(nil)
+	_ LogGroupDeleter   = (*cloudwatchlogs.Client)(nil)
+	_ LogStreamDeleter  = (*cloudwatchlogs.Client)(nil)
+)
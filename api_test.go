@@ -0,0 +1,509 @@
+package cwlogger
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockClient is a CloudWatchLogsAPI that records the log events written to it.
+type mockClient struct {
+	mu       sync.Mutex
+	calls    []string
+	messages map[string][]string // by log stream name
+	deleted  []string            // log stream names
+}
+
+func (m *mockClient) record(call string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, call)
+}
+
+func (m *mockClient) CreateLogGroup(ctx context.Context, params *cloudwatchlogs.CreateLogGroupInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogGroupOutput, error) {
+	m.record("CreateLogGroup")
+	return &cloudwatchlogs.CreateLogGroupOutput{}, nil
+}
+
+func (m *mockClient) PutRetentionPolicy(ctx context.Context, params *cloudwatchlogs.PutRetentionPolicyInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutRetentionPolicyOutput, error) {
+	m.record("PutRetentionPolicy")
+	return &cloudwatchlogs.PutRetentionPolicyOutput{}, nil
+}
+
+func (m *mockClient) DescribeLogGroups(ctx context.Context, params *cloudwatchlogs.DescribeLogGroupsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+	m.record("DescribeLogGroups")
+	return &cloudwatchlogs.DescribeLogGroupsOutput{}, nil
+}
+
+func (m *mockClient) CreateLogStream(ctx context.Context, params *cloudwatchlogs.CreateLogStreamInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+	m.record("CreateLogStream")
+	return &cloudwatchlogs.CreateLogStreamOutput{}, nil
+}
+
+func (m *mockClient) DescribeLogStreams(ctx context.Context, params *cloudwatchlogs.DescribeLogStreamsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DescribeLogStreamsOutput, error) {
+	m.record("DescribeLogStreams")
+	return &cloudwatchlogs.DescribeLogStreamsOutput{}, nil
+}
+
+func (m *mockClient) PutLogEvents(ctx context.Context, params *cloudwatchlogs.PutLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutLogEventsOutput, error) {
+	m.record("PutLogEvents")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.messages == nil {
+		m.messages = make(map[string][]string)
+	}
+	name := aws.ToString(params.LogStreamName)
+	for _, event := range params.LogEvents {
+		m.messages[name] = append(m.messages[name], aws.ToString(event.Message))
+	}
+	return &cloudwatchlogs.PutLogEventsOutput{}, nil
+}
+
+func (m *mockClient) DeleteLogGroup(ctx context.Context, params *cloudwatchlogs.DeleteLogGroupInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DeleteLogGroupOutput, error) {
+	m.record("DeleteLogGroup")
+	return &cloudwatchlogs.DeleteLogGroupOutput{}, nil
+}
+
+func (m *mockClient) DeleteLogStream(ctx context.Context, params *cloudwatchlogs.DeleteLogStreamInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DeleteLogStreamOutput, error) {
+	m.record("DeleteLogStream")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleted = append(m.deleted, aws.ToString(params.LogStreamName))
+	return &cloudwatchlogs.DeleteLogStreamOutput{}, nil
+}
+
+func TestMockClient(t *testing.T) {
+	client := new(mockClient)
+	logger, err := New(&Config{
+		Client:       client,
+		LogGroupName: "test",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	logger.Log(time.Now(), "first")
+	logger.Log(time.Now(), "second")
+	logger.Close()
+
+	assert.Equal(t, []string{"CreateLogGroup", "CreateLogStream", "PutLogEvents"}, client.calls)
+	assert.Equal(t, map[string][]string{
+		logger.StreamNames()[0]: {"first", "second"},
+	}, client.messages)
+}
+
+func TestDeleteLogGroup(t *testing.T) {
+	client := new(mockClient)
+	logger, err := New(&Config{
+		Client:       client,
+		LogGroupName: "test",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	logger.Log(time.Now(), "message")
+	assert.NoError(t, logger.DeleteLogGroup(context.Background()))
+
+	assert.Equal(t, []string{"CreateLogGroup", "CreateLogStream", "PutLogEvents", "DeleteLogGroup"}, client.calls)
+	assert.Equal(t, ErrClosed, logger.LogE(time.Now(), "message"))
+}
+
+func TestCleanupEmptyStreams(t *testing.T) {
+	client := new(mockClient)
+	logger, err := New(&Config{
+		Client:              client,
+		LogGroupName:        "test",
+		Streams:             2,
+		CleanupEmptyStreams: true,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	logger.Log(time.Now(), "message")
+	logger.Close()
+
+	names := logger.StreamNames()
+	if assert.Len(t, names, 2) && assert.Len(t, client.messages, 1) {
+		used, unused := names[0], names[1]
+		if _, ok := client.messages[used]; !ok {
+			used, unused = unused, used
+		}
+		assert.Equal(t, []string{"message"}, client.messages[used])
+		assert.Equal(t, []string{unused}, client.deleted)
+	}
+}
+
+func TestEmptyStreamsKeptByDefault(t *testing.T) {
+	client := new(mockClient)
+	logger, err := New(&Config{
+		Client:       client,
+		LogGroupName: "test",
+		Streams:      2,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	logger.Log(time.Now(), "message")
+	logger.Close()
+
+	assert.Empty(t, client.deleted)
+	assert.NotContains(t, client.calls, "DeleteLogStream")
+}
+
+func TestLogKeyed(t *testing.T) {
+	client := new(mockClient)
+	logger, err := New(&Config{
+		Client:       client,
+		LogGroupName: "test",
+		Streams:      3,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for i := 1; i <= 3; i++ {
+		for _, key := range []string{"tenant-a", "tenant-b", "tenant-c"} {
+			logger.LogKeyed(key, time.Now(), key+"-"+strconv.Itoa(i))
+		}
+		logger.Flush()
+	}
+	logger.Close()
+
+	// Each key's log messages were all written to the same log stream.
+	streams := map[string]string{}
+	for name, messages := range client.messages {
+		for _, message := range messages {
+			key := message[:strings.LastIndex(message, "-")]
+			if stream, ok := streams[key]; ok {
+				assert.Equal(t, stream, name, "log messages of %s written to different log streams", key)
+			}
+			streams[key] = name
+		}
+	}
+	assert.Len(t, streams, 3)
+}
+
+func TestLogKeyedBatchesByLogStream(t *testing.T) {
+	for _, streams := range []int{1, 3} {
+		client := new(mockClient)
+		logger, err := New(&Config{
+			Client:       client,
+			LogGroupName: "test",
+			Streams:      streams,
+		})
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		for i := 0; i < 200; i++ {
+			logger.LogKeyed("key-"+strconv.Itoa(i), time.Now(), "message")
+		}
+		logger.Close()
+
+		// Log events with different keys for the same log stream are batched
+		// together, so there's at most one batch for each log stream.
+		var puts int
+		for _, call := range client.calls {
+			if call == "PutLogEvents" {
+				puts++
+			}
+		}
+		assert.True(t, puts >= 1 && puts <= streams, "%d batches for %d log streams", puts, streams)
+	}
+}
+
+func TestAddStream(t *testing.T) {
+	client := new(mockClient)
+	logger, err := New(&Config{
+		Client:       client,
+		LogGroupName: "test",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 1, logger.StreamCount())
+
+	assert.NoError(t, logger.AddStream())
+	assert.Equal(t, 2, logger.StreamCount())
+
+	for _, message := range []string{"first", "second", "third", "fourth"} {
+		logger.Log(time.Now(), message)
+		logger.Flush()
+	}
+	logger.Close()
+
+	names := logger.StreamNames()
+	if assert.Len(t, names, 2) {
+		assert.Len(t, client.messages[names[0]], 2)
+		assert.Len(t, client.messages[names[1]], 2)
+	}
+}
+
+func TestAddStreamToSingleStream(t *testing.T) {
+	logger, err := New(&Config{
+		Client:        new(mockClient),
+		LogGroupName:  "test",
+		LogStreamName: "stream",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer logger.Close()
+
+	assert.Error(t, logger.AddStream())
+	assert.Equal(t, 1, logger.StreamCount())
+}
+
+func TestLogToStream(t *testing.T) {
+	client := new(mockClient)
+	logger, err := New(&Config{
+		Client:       client,
+		LogGroupName: "test",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	logger.Log(time.Now(), "default")
+	logger.LogToStream("tenant-a", time.Now(), "first a")
+	logger.LogToStream("tenant-b", time.Now(), "first b")
+	logger.LogToStream("tenant-a", time.Now(), "second a")
+	logger.Flush()
+	client.mu.Lock()
+	assert.Len(t, client.messages, 3)
+	client.mu.Unlock()
+	logger.Close()
+
+	assert.Equal(t, map[string][]string{
+		logger.StreamNames()[0]: {"default"},
+		"tenant-a":              {"first a", "second a"},
+		"tenant-b":              {"first b"},
+	}, client.messages)
+	assert.Equal(t, 1, logger.StreamCount())
+	assert.EqualValues(t, 4, logger.Stats().EventsAccepted)
+	assert.EqualValues(t, 3, logger.Stats().BatchesSent)
+}
+
+func TestLogToStreamAfterClose(t *testing.T) {
+	var reported []error
+	logger, err := New(&Config{
+		Client:        new(mockClient),
+		LogGroupName:  "test",
+		ErrorReporter: func(err error) { reported = append(reported, err) },
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	logger.Close()
+	logger.LogToStream("tenant-a", time.Now(), "message")
+
+	assert.Equal(t, []error{ErrClosed}, reported)
+}
+
+// slowStreamClient is a mockClient whose CreateLogStream calls for the log
+// stream named slow wait for release to be closed.
+type slowStreamClient struct {
+	*mockClient
+	slow    string
+	release chan struct{}
+}
+
+func (c *slowStreamClient) CreateLogStream(ctx context.Context, params *cloudwatchlogs.CreateLogStreamInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+	if *params.LogStreamName == c.slow {
+		<-c.release
+	}
+	return c.mockClient.CreateLogStream(ctx, params, optFns...)
+}
+
+func TestLogToStreamIsNotHeldUpByCreatingAnother(t *testing.T) {
+	client := &slowStreamClient{mockClient: new(mockClient), slow: "tenant-a", release: make(chan struct{})}
+	logger, err := New(&Config{
+		Client:       client,
+		LogGroupName: "test",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	logged := make(chan struct{})
+	go func() {
+		logger.LogToStream("tenant-a", time.Now(), "first a")
+		logger.LogToStream("tenant-a", time.Now(), "second a")
+		close(logged)
+	}()
+	logger.LogToStream("tenant-b", time.Now(), "first b")
+	logger.Flush()
+	client.mu.Lock()
+	assert.Equal(t, []string{"first b"}, client.messages["tenant-b"])
+	client.mu.Unlock()
+
+	close(client.release)
+	<-logged
+	logger.Close()
+
+	assert.Equal(t, []string{"first a", "second a"}, client.messages["tenant-a"])
+}
+
+func TestMaxPinnedStreams(t *testing.T) {
+	client := new(mockClient)
+	var reported []error
+	logger, err := New(&Config{
+		Client:           client,
+		LogGroupName:     "test",
+		MaxPinnedStreams: 2,
+		ErrorReporter:    func(err error) { reported = append(reported, err) },
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	logger.LogToStream("tenant-a", time.Now(), "a")
+	logger.LogToStream("tenant-b", time.Now(), "b")
+	logger.LogToStream("tenant-c", time.Now(), "c")
+	logger.LogToStream("tenant-a", time.Now(), "a again")
+	logger.Close()
+
+	assert.Equal(t, []string{"a", "a again"}, client.messages["tenant-a"])
+	assert.Equal(t, []string{"b"}, client.messages["tenant-b"])
+	assert.NotContains(t, client.messages, "tenant-c")
+	assert.Equal(t, []error{ErrTooManyStreams}, reported)
+}
+
+// flakyStreamClient is a mockClient whose next failures calls to
+// CreateLogStream fail.
+type flakyStreamClient struct {
+	*mockClient
+	failures int
+}
+
+func (c *flakyStreamClient) CreateLogStream(ctx context.Context, params *cloudwatchlogs.CreateLogStreamInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+	c.mu.Lock()
+	fail := c.failures > 0
+	c.failures--
+	c.mu.Unlock()
+	if fail {
+		c.record("CreateLogStream")
+		return nil, &types.ServiceUnavailableException{}
+	}
+	return c.mockClient.CreateLogStream(ctx, params, optFns...)
+}
+
+// removeStreams leaves the Logger without any log streams to write to. New
+// fails, or starts writing to the FallbackWriter, when it can't create the
+// initial log streams, so this is only a safeguard for the coordinator, which
+// creates a log stream when it has none.
+func removeStreams(logger *Logger) {
+	logger.streams.mu.Lock()
+	defer logger.streams.mu.Unlock()
+	logger.streams.streams = nil
+}
+
+func TestWritesWithoutStreamsCreateOne(t *testing.T) {
+	withoutJitter(t, time.Millisecond)
+	client := &flakyStreamClient{mockClient: new(mockClient)}
+	logger, err := New(&Config{
+		Client:       client,
+		LogGroupName: "test",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	removeStreams(logger)
+	client.mu.Lock()
+	client.failures = 2
+	client.mu.Unlock()
+
+	assert.NotPanics(t, func() {
+		logger.Log(time.Now(), "message")
+		logger.Flush()
+		logger.Close()
+	})
+
+	assert.Equal(t, []string{
+		"CreateLogGroup", "CreateLogStream",
+		"CreateLogStream", "CreateLogStream", "CreateLogStream",
+		"PutLogEvents",
+	}, client.calls)
+	names := logger.StreamNames()
+	if assert.Len(t, names, 1) {
+		assert.Equal(t, map[string][]string{names[0]: {"message"}}, client.messages)
+	}
+}
+
+func TestWritesWithoutStreamsDroppedWhenCreateFails(t *testing.T) {
+	withoutJitter(t, time.Millisecond)
+	client := &flakyStreamClient{mockClient: new(mockClient)}
+	var reported []error
+	logger, err := New(&Config{
+		Client:       client,
+		LogGroupName: "test",
+		MaxRetries:   2,
+		ErrorReporter: func(err error) {
+			reported = append(reported, err)
+		},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	removeStreams(logger)
+	client.mu.Lock()
+	client.failures = 1000
+	client.mu.Unlock()
+
+	logger.Log(time.Now(), "message")
+	logger.Flush()
+	logger.Close()
+
+	// The log stream is created with up to MaxRetries retries, then the batch
+	// is dropped.
+	assert.Equal(t, []string{
+		"CreateLogGroup", "CreateLogStream",
+		"CreateLogStream", "CreateLogStream", "CreateLogStream",
+	}, client.calls)
+	if assert.Len(t, reported, 1) {
+		var dropped *DroppedBatchError
+		assert.True(t, errors.As(reported[0], &dropped))
+		var unavailable *types.ServiceUnavailableException
+		assert.True(t, errors.As(reported[0], &unavailable))
+	}
+	assert.EqualValues(t, 1, logger.Stats().EventsDropped)
+}
+
+func TestCloseStopsCreatingStreams(t *testing.T) {
+	withoutJitter(t, time.Hour)
+	client := &flakyStreamClient{mockClient: new(mockClient)}
+	logger, err := New(&Config{
+		Client:       client,
+		LogGroupName: "test",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	removeStreams(logger)
+	client.mu.Lock()
+	client.failures = 1000
+	client.mu.Unlock()
+
+	// Once closing, the log stream isn't retried after the first attempt.
+	logger.Log(time.Now(), "message")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, logger.CloseContext(ctx), "Close waited for the retry delay")
+	assert.EqualValues(t, 1, logger.Stats().EventsDropped)
+}
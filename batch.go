@@ -1,37 +1,185 @@
 package cwlogger
 
 import (
+	"fmt"
 	"sort"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
 )
 
 const (
 	maxBatchByteSize = 1048576
 	maxBatchLength   = 10000
+
+	// logEventOverhead is the number of bytes CloudWatch Logs adds to the size
+	// of each log message when counting it towards the batch size limit. All
+	// sizes are computed with eventSize, so it's only defined here.
 	logEventOverhead = 26
+
+	// maxMessageSize is the size of the largest log message that fits in a
+	// batch on its own.
+	maxMessageSize = MaxEventSize - logEventOverhead
+
+	// maxBatchTimeSpan is the maximum time in milliseconds between the
+	// earliest and latest log events in a batch.
+	maxBatchTimeSpan = int64(24 * time.Hour / time.Millisecond)
+
+	defaultFlushInterval = time.Second
+
+	defaultMaxQueueSize = maxBatchLength
 )
 
+// MaxEventSize is the largest size of a log event, as returned by
+// EstimateEventSize, that the Logger accepts.
+const MaxEventSize = maxBatchByteSize
+
+// EstimateEventSize returns the size CloudWatch Logs counts for a log event
+// with the given message: its length in bytes, once encoded as UTF-8, plus a
+// fixed overhead. Log messages with an estimated size over MaxEventSize are
+// rejected with ErrMessageTooLarge.
+func EstimateEventSize(message string) int {
+	return eventSize(message)
+}
+
+// eventSize returns the size of a log event with the given message, as counted
+// towards the batch size limit.
+func eventSize(message string) int {
+	return len(message) + logEventOverhead
+}
+
+// batchSize returns the total size of the log events, as counted towards the
+// batch size limit.
+func batchSize(logEvents []types.InputLogEvent) int {
+	size := 0
+	for _, logEvent := range logEvents {
+		size += eventSize(*logEvent.Message)
+	}
+	return size
+}
+
+// A logEvent is a log event waiting to be batched, along with an optional
+// channel on which the outcome of writing it is delivered.
+type logEvent struct {
+	types.InputLogEvent
+	done chan<- error
+
+	// nanos is the full precision of the timestamp, in nanoseconds since the
+	// epoch, so that log events in the same millisecond keep their order.
+	nanos int64
+
+	// slot is the log stream affinity of a log event logged with LogKeyed, or
+	// zero. Log events with different slots are batched separately.
+	slot int
+}
+
 type batch struct {
 	logEvents []types.InputLogEvent
+	nanos     []int64 // of each of the logEvents
+	added     []int   // the order in which each of the logEvents was added
+	dones     []chan<- error
+	waiting   []int // the logEvents each of the dones waits on, in added order
 	size      int
+	minTime   int64
+	maxTime   int64
+
+	// When coalescing, repeats counts the consecutive log events with the same
+	// message as the last one, and coalesced the log events folded into an
+	// earlier one.
+	coalesce  bool
+	repeats   int
+	coalesced int
 }
 
-func newBatch() *batch {
+func newBatch(coalesce bool) *batch {
 	return &batch{
 		logEvents: []types.InputLogEvent{},
+		coalesce:  coalesce,
+	}
+}
+
+// repeatSuffix returns the suffix appended to a log message repeated n times.
+func repeatSuffix(n int) string {
+	if n <= 1 {
+		return ""
 	}
+	return fmt.Sprintf(" (repeated %d times)", n)
 }
 
-func (b *batch) add(logEvent types.InputLogEvent) (ok bool) {
-	size := len(*logEvent.Message) + logEventOverhead
-	if size+b.size <= maxBatchByteSize && len(b.logEvents) < maxBatchLength {
-		b.logEvents = append(b.logEvents, logEvent)
-		b.size += size
+func (b *batch) add(logEvent logEvent) (ok bool) {
+	if b.coalesce && len(b.logEvents) > 0 && *b.logEvents[len(b.logEvents)-1].Message == *logEvent.Message {
+		growth := len(repeatSuffix(b.repeats+1)) - len(repeatSuffix(b.repeats))
+		if b.size+growth > maxBatchByteSize {
+			return false
+		}
+		b.repeats++
+		b.coalesced++
+		b.size += growth
+		b.addDone(logEvent.done)
 		return true
 	}
-	return false
+	b.endRepeats()
+
+	size := eventSize(*logEvent.Message)
+	if size+b.size > maxBatchByteSize || len(b.logEvents) >= maxBatchLength {
+		return false
+	}
+
+	minTime, maxTime := *logEvent.Timestamp, *logEvent.Timestamp
+	if len(b.logEvents) > 0 {
+		if b.minTime < minTime {
+			minTime = b.minTime
+		}
+		if b.maxTime > maxTime {
+			maxTime = b.maxTime
+		}
+	}
+	if maxTime-minTime > maxBatchTimeSpan {
+		return false
+	}
+
+	b.added = append(b.added, len(b.logEvents))
+	b.logEvents = append(b.logEvents, logEvent.InputLogEvent)
+	b.nanos = append(b.nanos, logEvent.nanos)
+	b.size += size
+	b.minTime, b.maxTime = minTime, maxTime
+	b.repeats = 1
+	b.addDone(logEvent.done)
+	return true
+}
+
+// addDone adds the channel of a log event waiting on the outcome of writing the
+// last of the logEvents, which it was added as or coalesced into.
+func (b *batch) addDone(done chan<- error) {
+	if done != nil {
+		b.dones = append(b.dones, done)
+		b.waiting = append(b.waiting, len(b.logEvents)-1)
+	}
+}
+
+// doneEvents returns the index in the logEvents, once sorted, of the log event
+// each of the dones waits on.
+func (b *batch) doneEvents() []int {
+	at := make([]int, len(b.added))
+	for i, j := range b.added {
+		at[j] = i
+	}
+	events := make([]int, len(b.waiting))
+	for k, j := range b.waiting {
+		events[k] = at[j]
+	}
+	return events
+}
+
+// endRepeats appends the repeat count to the last log message if it was
+// repeated.
+func (b *batch) endRepeats() {
+	if b.repeats > 1 {
+		last := &b.logEvents[len(b.logEvents)-1]
+		last.Message = aws.String(*last.Message + repeatSuffix(b.repeats))
+	}
+	b.repeats = 0
 }
 
 func (b *batch) Len() int {
@@ -39,22 +187,32 @@ func (b *batch) Len() int {
 }
 
 func (b *batch) Less(i, j int) bool {
-	return *b.logEvents[i].Timestamp < *b.logEvents[j].Timestamp
+	return b.nanos[i] < b.nanos[j]
 }
 
 func (b *batch) Swap(i, j int) {
 	b.logEvents[i], b.logEvents[j] = b.logEvents[j], b.logEvents[i]
+	b.nanos[i], b.nanos[j] = b.nanos[j], b.nanos[i]
+	b.added[i], b.added[j] = b.added[j], b.added[i]
 }
 
 type batcher struct {
-	input  chan types.InputLogEvent
-	output chan []types.InputLogEvent
+	input         chan logEvent
+	output        chan *pendingBatch
+	flushInterval time.Duration
+	flushes       chan struct{}
+	clock         clock
+	coalesce      bool
 }
 
-func newBatcher() *batcher {
+func newBatcher(flushInterval time.Duration, queueSize int, clock clock, coalesce bool) *batcher {
 	b := &batcher{
-		input:  make(chan types.InputLogEvent),
-		output: make(chan []types.InputLogEvent),
+		input:         make(chan logEvent, queueSize),
+		output:        make(chan *pendingBatch),
+		flushInterval: flushInterval,
+		flushes:       make(chan struct{}, 1),
+		clock:         clock,
+		coalesce:      coalesce,
 	}
 	go b.worker()
 	return b
@@ -64,17 +222,68 @@ func (br *batcher) flush() {
 	close(br.input)
 }
 
+// requestFlush asks the batcher to send the log events currently in its queue
+// without waiting for the batch to fill up or the flush interval to elapse.
+func (br *batcher) requestFlush() {
+	select {
+	case br.flushes <- struct{}{}:
+	default: // a flush is already pending
+	}
+}
+
 func (br *batcher) worker() {
-	b := newBatch()
-	timeout := time.After(time.Second)
+	// batches holds the batch being built for each slot, only while it is not
+	// empty.
+	batches := map[int]*batch{}
+
+	// timeout is only set while a batch is not empty, so that a batch is sent
+	// no later than flushInterval after its first log event was added.
+	var timeout <-chan time.Time
+
+	send := func(slot int) {
+		b := batches[slot]
+		delete(batches, slot)
+		b.endRepeats()
+		sort.Stable(b)
+		br.output <- &pendingBatch{
+			logEvents:  b.logEvents,
+			dones:      b.dones,
+			doneEvents: b.doneEvents(),
+			coalesced:  b.coalesced,
+			slot:       slot,
+		}
+	}
 
 	flush := func() {
-		if len(b.logEvents) > 0 {
-			sort.Sort(b)
-			br.output <- b.logEvents
-			b = newBatch()
+		slots := make([]int, 0, len(batches))
+		for slot := range batches {
+			slots = append(slots, slot)
+		}
+		sort.Ints(slots)
+		for _, slot := range slots {
+			send(slot)
+		}
+		timeout = nil
+	}
+
+	add := func(logEvent logEvent) {
+		b := batches[logEvent.slot]
+		if b == nil {
+			b = newBatch(br.coalesce)
+			batches[logEvent.slot] = b
+		}
+		if ok := b.add(logEvent); !ok {
+			send(logEvent.slot)
+			if len(batches) == 0 {
+				timeout = nil
+			}
+			b = newBatch(br.coalesce)
+			batches[logEvent.slot] = b
+			b.add(logEvent)
+		}
+		if timeout == nil {
+			timeout = br.clock.After(br.flushInterval)
 		}
-		timeout = time.After(time.Second)
 	}
 
 	for {
@@ -85,10 +294,12 @@ func (br *batcher) worker() {
 				close(br.output)
 				return
 			}
-			if ok := b.add(logEvent); !ok {
-				flush()
-				b.add(logEvent)
+			add(logEvent)
+		case <-br.flushes:
+			for n := len(br.input); n > 0; n-- {
+				add(<-br.input)
 			}
+			flush()
 		case <-timeout:
 			flush()
 		}
@@ -0,0 +1,188 @@
+package cwlogger
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatcherSplitsAtMaxBatchLength(t *testing.T) {
+	br := newBatcher(defaultFlushInterval, defaultMaxQueueSize, realClock{}, false)
+	go func() {
+		for i := 0; i < 25001; i++ {
+			br.input <- testEvent(time.Now(), "message")
+		}
+		br.flush()
+	}()
+
+	lengths := []int{}
+	for b := range br.output {
+		batch := b.logEvents
+		lengths = append(lengths, len(batch))
+	}
+
+	assert.Equal(t, []int{10000, 10000, 5001}, lengths)
+}
+
+func TestBatcherSeparatesSlots(t *testing.T) {
+	br := newBatcher(defaultFlushInterval, defaultMaxQueueSize, realClock{}, false)
+	go func() {
+		for i, slot := range []int{0, 2, 0, 1, 2} {
+			event := testEvent(time.Now(), strconv.Itoa(i))
+			event.slot = slot
+			br.input <- event
+		}
+		br.flush()
+	}()
+
+	batches := map[int][]string{}
+	for b := range br.output {
+		for _, event := range b.logEvents {
+			batches[b.slot] = append(batches[b.slot], *event.Message)
+		}
+	}
+
+	assert.Equal(t, map[int][]string{0: {"0", "2"}, 1: {"3"}, 2: {"1", "4"}}, batches)
+}
+
+func testEvent(t time.Time, message string) logEvent {
+	return logEvent{
+		InputLogEvent: types.InputLogEvent{
+			Message:   aws.String(message),
+			Timestamp: aws.Int64(t.UnixNano() / int64(time.Millisecond)),
+		},
+		nanos: t.UnixNano(),
+	}
+}
+
+func TestBatcherSplitsAtMaxBatchByteSize(t *testing.T) {
+	br := newBatcher(defaultFlushInterval, defaultMaxQueueSize, realClock{}, false)
+	go func() {
+		for i := 0; i < 20; i++ {
+			br.input <- testEvent(time.Now(), strings.Repeat(".", 200*1024))
+		}
+		br.input <- testEvent(time.Now(), strings.Repeat(".", maxMessageSize))
+		br.input <- testEvent(time.Now(), "message")
+		br.flush()
+	}()
+
+	events := 0
+	for b := range br.output {
+		batch := b.logEvents
+		size := batchSize(batch)
+		assert.True(t, size <= maxBatchByteSize, "batch size %d exceeds limit", size)
+		if size == maxBatchByteSize {
+			assert.Len(t, batch, 1)
+		}
+		events += len(batch)
+	}
+
+	assert.Equal(t, 22, events)
+}
+
+func TestBatchSizeCountsOverhead(t *testing.T) {
+	message := strings.Repeat(".", maxBatchByteSize/4-logEventOverhead)
+	assert.Equal(t, maxBatchByteSize/4, eventSize(message))
+
+	b := newBatch(false)
+	for i := 0; i < 4; i++ {
+		assert.True(t, b.add(testEvent(time.Now(), message)), "event %d should fit", i)
+	}
+	assert.Equal(t, maxBatchByteSize, b.size)
+	assert.Equal(t, maxBatchByteSize, batchSize(b.logEvents))
+	assert.False(t, b.add(testEvent(time.Now(), "")), "an empty message still counts the overhead")
+
+	assert.True(t, newBatch(false).add(testEvent(time.Now(), strings.Repeat(".", maxMessageSize))))
+	assert.False(t, newBatch(false).add(testEvent(time.Now(), strings.Repeat(".", maxMessageSize+1))))
+}
+
+func TestEstimateEventSize(t *testing.T) {
+	for _, message := range []string{"", "hello", "héllo wörld", "日本語", strings.Repeat(".", maxMessageSize)} {
+		b := newBatch(false)
+		assert.True(t, b.add(testEvent(time.Now(), message)))
+		assert.Equal(t, b.size, EstimateEventSize(message), "%.20q", message)
+		assert.Equal(t, batchSize(b.logEvents), EstimateEventSize(message), "%.20q", message)
+	}
+	assert.Equal(t, MaxEventSize, EstimateEventSize(strings.Repeat(".", maxMessageSize)))
+	assert.Equal(t, len("日本語")+logEventOverhead, EstimateEventSize("日本語"))
+}
+
+func TestBatcherSplitsAtMaxBatchTimeSpan(t *testing.T) {
+	start := time.Now().Add(-48 * time.Hour)
+	br := newBatcher(defaultFlushInterval, defaultMaxQueueSize, realClock{}, false)
+	go func() {
+		for i := 0; i < 10; i++ {
+			br.input <- testEvent(start, "early")
+			br.input <- testEvent(start.Add(25*time.Hour), "late")
+			br.input <- testEvent(start.Add(time.Hour), "early")
+		}
+		br.flush()
+	}()
+
+	events := 0
+	for b := range br.output {
+		batch := b.logEvents
+		first := *batch[0].Timestamp
+		last := *batch[len(batch)-1].Timestamp
+		assert.True(t, last-first <= maxBatchTimeSpan, "batch spans %dms", last-first)
+		events += len(batch)
+	}
+
+	assert.Equal(t, 30, events)
+}
+
+func TestBatcherOrdersWithinMillisecond(t *testing.T) {
+	start := time.Now().Truncate(time.Millisecond)
+	br := newBatcher(defaultFlushInterval, defaultMaxQueueSize, realClock{}, false)
+	go func() {
+		br.input <- testEvent(start.Add(2*time.Millisecond), "fourth")
+		br.input <- testEvent(start.Add(200*time.Microsecond), "third")
+		br.input <- testEvent(start.Add(100*time.Microsecond), "second")
+		br.input <- testEvent(start, "first")
+		br.flush()
+	}()
+
+	var messages []string
+	var timestamps []int64
+	for b := range br.output {
+		for _, event := range b.logEvents {
+			messages = append(messages, *event.Message)
+			timestamps = append(timestamps, *event.Timestamp)
+		}
+	}
+
+	ms := start.UnixNano() / int64(time.Millisecond)
+	assert.Equal(t, []string{"first", "second", "third", "fourth"}, messages)
+	assert.Equal(t, []int64{ms, ms, ms, ms + 2}, timestamps)
+}
+
+func TestBatcherCoalescesDuplicates(t *testing.T) {
+	start := time.Now()
+	br := newBatcher(defaultFlushInterval, defaultMaxQueueSize, realClock{}, true)
+	go func() {
+		for i := 0; i < 100; i++ {
+			br.input <- testEvent(start.Add(time.Duration(i)*time.Millisecond), "same")
+		}
+		br.input <- testEvent(start, "different")
+		br.input <- testEvent(start, "same")
+		br.flush()
+	}()
+
+	var messages []string
+	var coalesced int
+	for b := range br.output {
+		for _, event := range b.logEvents {
+			messages = append(messages, *event.Message)
+		}
+		assert.Equal(t, start.UnixNano()/int64(time.Millisecond), *b.logEvents[0].Timestamp)
+		coalesced += b.coalesced
+	}
+
+	assert.Equal(t, []string{"same (repeated 100 times)", "different", "same"}, messages)
+	assert.Equal(t, 99, coalesced)
+}
@@ -0,0 +1,122 @@
+package cwlogger
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultBreakerCooldown = 30 * time.Second
+
+// CircuitBreaker configures when the Logger stops writing to CloudWatch Logs
+// after repeated failures. Once Failures consecutive PutLogEvents calls have
+// failed the circuit breaker opens, and batches are dropped without being
+// written, or retried, until the Cooldown has elapsed. The next batch is then
+// written as a trial, with other batches still dropped while it is in flight:
+// if it succeeds the circuit breaker closes, and if it fails the circuit
+// breaker opens again for another Cooldown.
+//
+// Opening the circuit breaker is reported to the ErrorReporter as a single
+// error wrapping ErrCircuitOpen, instead of an error for each dropped batch.
+type CircuitBreaker struct {
+	// The number of consecutive failures after which to open the circuit
+	// breaker. Zero disables the circuit breaker.
+	Failures int
+
+	// How long the circuit breaker stays open before letting a trial batch
+	// through. Defaults to 30 seconds.
+	Cooldown time.Duration
+}
+
+// A breaker tracks the state of a CircuitBreaker. It is safe for concurrent
+// use.
+type breaker struct {
+	config CircuitBreaker
+	clock  clock
+
+	mu       sync.Mutex
+	failures int // consecutive failures
+	open     bool
+	openedAt time.Time
+
+	// Whether a trial batch has been let through and hasn't yet succeeded or
+	// failed. openedAt is reset when it is let through, so if it is lost
+	// without being written, another is let through after another Cooldown.
+	trialInFlight bool
+}
+
+func newBreaker(config CircuitBreaker, clock clock) *breaker {
+	if config.Cooldown <= 0 {
+		config.Cooldown = defaultBreakerCooldown
+	}
+	return &breaker{config: config, clock: clock}
+}
+
+// allow reports whether a batch may be written, which it may unless the
+// circuit breaker is open. Once the Cooldown has elapsed a single batch is
+// allowed, as the trial.
+func (b *breaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return true
+	}
+	now := b.clock.Now()
+	if now.Sub(b.openedAt) < b.config.Cooldown {
+		return false
+	}
+	b.trialInFlight = true
+	b.openedAt = now
+	return true
+}
+
+// cooling reports whether the circuit breaker is open and either cooling down
+// or waiting for a trial batch, so that a failed batch isn't worth retrying.
+func (b *breaker) cooling() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open && b.clock.Now().Sub(b.openedAt) < b.config.Cooldown
+}
+
+// success records a successful write, closing the circuit breaker.
+func (b *breaker) success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.open = false
+	b.trialInFlight = false
+}
+
+// failure records a failed write, returning whether it opened the circuit
+// breaker, which it does after enough consecutive failures, or when a trial
+// batch fails.
+func (b *breaker) failure() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.failures < b.config.Failures {
+		return false
+	}
+	// Another failure while already open, other than of the trial batch, is
+	// from a batch written before the circuit breaker opened, and doesn't
+	// restart the cooldown.
+	now := b.clock.Now()
+	if b.open && !b.trialInFlight && now.Sub(b.openedAt) < b.config.Cooldown {
+		return false
+	}
+	b.open = true
+	b.openedAt = now
+	b.trialInFlight = false
+	return true
+}
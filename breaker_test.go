@@ -0,0 +1,111 @@
+package cwlogger
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	clk := newFakeClock(time.Now())
+	b := newBreaker(CircuitBreaker{Failures: 2, Cooldown: time.Minute}, clk)
+
+	assert.False(t, b.failure())
+	assert.True(t, b.allow())
+	assert.True(t, b.failure())
+	assert.False(t, b.allow())
+	assert.False(t, b.failure(), "failures while cooling down don't reopen the breaker")
+
+	clk.Advance(time.Minute)
+	assert.True(t, b.allow())
+	assert.False(t, b.allow(), "only one trial batch is let through")
+	assert.True(t, b.failure(), "a failed trial reopens the breaker")
+	assert.False(t, b.allow())
+
+	// A trial batch that is never written doesn't keep the breaker open.
+	clk.Advance(time.Minute)
+	assert.True(t, b.allow())
+	assert.False(t, b.allow())
+	clk.Advance(time.Minute)
+	assert.True(t, b.allow())
+	b.success()
+	assert.True(t, b.allow())
+	assert.True(t, b.allow())
+	assert.False(t, b.failure())
+}
+
+// failingClient is a mockClient whose PutLogEvents calls fail while failing is
+// set.
+type failingClient struct {
+	*mockClient
+	failing bool
+	puts    int
+}
+
+func (c *failingClient) PutLogEvents(ctx context.Context, params *cloudwatchlogs.PutLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutLogEventsOutput, error) {
+	c.mu.Lock()
+	c.puts++
+	failing := c.failing
+	c.mu.Unlock()
+	if failing {
+		return nil, &types.ServiceUnavailableException{}
+	}
+	return c.mockClient.PutLogEvents(ctx, params, optFns...)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	withoutJitter(t, time.Millisecond)
+	clk := newFakeClock(time.Now())
+	client := &failingClient{mockClient: new(mockClient), failing: true}
+	var mu sync.Mutex
+	var reported []error
+	logger, err := New(&Config{
+		Client:         client,
+		LogGroupName:   "test",
+		MaxRetries:     2,
+		CircuitBreaker: CircuitBreaker{Failures: 3, Cooldown: time.Minute},
+		ErrorReporter: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			reported = append(reported, err)
+		},
+		clock: clk,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// The batch fails three times, opening the breaker.
+	logger.Log(clk.Now(), "first")
+	logger.Flush()
+	assert.Equal(t, 3, client.puts)
+
+	// Batches are dropped without being written while the breaker is open.
+	logger.Log(clk.Now(), "second")
+	logger.Flush()
+	assert.Equal(t, 3, client.puts)
+
+	client.mu.Lock()
+	client.failing = false
+	client.mu.Unlock()
+	clk.Advance(time.Minute)
+
+	logger.Log(clk.Now(), "third")
+	logger.Flush()
+	logger.Log(clk.Now(), "fourth")
+	logger.Close()
+
+	assert.Equal(t, 5, client.puts)
+	assert.Equal(t, []string{"third", "fourth"}, client.messages[logger.StreamNames()[0]])
+	assert.EqualValues(t, 2, logger.Stats().EventsDropped)
+	if assert.Len(t, reported, 1) {
+		assert.True(t, errors.Is(reported[0], ErrCircuitOpen))
+		assert.Equal(t, "cwlogger: circuit breaker open after 3 consecutive failures: ServiceUnavailableException", reported[0].Error())
+	}
+}
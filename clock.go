@@ -0,0 +1,23 @@
+package cwlogger
+
+import (
+	"time"
+)
+
+// A clock tells the time, so that tests can control the flush interval and the
+// validation of log event timestamps.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the clock of the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
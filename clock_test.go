@@ -0,0 +1,101 @@
+package cwlogger
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a clock that only moves when advanced.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	timer := fakeTimer{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	c.timers = append(c.timers, timer)
+	return timer.c
+}
+
+// Advance moves the clock forward, firing the timers that are due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.at.After(c.now) {
+			pending = append(pending, timer)
+		} else {
+			timer.c <- c.now
+		}
+	}
+	c.timers = pending
+}
+
+// Timers returns the number of timers that haven't fired yet.
+func (c *fakeClock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+func TestBatcherFlushesOnFakeClock(t *testing.T) {
+	clk := newFakeClock(time.Now())
+	br := newBatcher(time.Second, defaultMaxQueueSize, clk, false)
+	defer br.flush()
+
+	br.input <- testEvent(clk.Now(), "message")
+	assert.Eventually(t, func() bool { return clk.Timers() == 1 }, time.Second, time.Millisecond)
+
+	clk.Advance(999 * time.Millisecond)
+	select {
+	case <-br.output:
+		t.Fatal("batch sent before the flush interval elapsed")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	clk.Advance(time.Millisecond)
+	select {
+	case b := <-br.output:
+		assert.Len(t, b.logEvents, 1)
+	case <-time.After(time.Second):
+		t.Fatal("batch not sent once the flush interval elapsed")
+	}
+}
+
+func TestCheckTimeOnFakeClock(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	logger := newLoggerWithServer(&Config{
+		LogGroupName: "test",
+		DryRun:       true,
+		clock:        newFakeClock(now),
+	}, nil)
+	defer logger.Close()
+
+	assert.NoError(t, logger.LogE(now.Add(-maxEventAge), "oldest"))
+	assert.Equal(t, ErrEventTooOld, logger.LogE(now.Add(-maxEventAge-time.Millisecond), "too old"))
+	assert.NoError(t, logger.LogE(now.Add(defaultMaxFutureSkew), "newest"))
+	assert.Equal(t, ErrEventTooNew, logger.LogE(now.Add(defaultMaxFutureSkew+time.Millisecond), "too new"))
+}
@@ -0,0 +1,24 @@
+package cwlogger
+
+// A credentialsInvalidator is a credentials provider that caches credentials,
+// such as *aws.CredentialsCache, which the SDK wraps the credentials provider
+// of a client in.
+type credentialsInvalidator interface {
+	Invalidate()
+}
+
+// refreshCredentials invalidates the cached credentials of the client, if it
+// exposes them, so that the next request retrieves them again from the
+// credentials provider, for example after temporary credentials have expired
+// earlier than the cache expected. It reports whether they were invalidated.
+func (lg *Logger) refreshCredentials() bool {
+	options, _ := resolveOptions(lg.svc, lg.clientOptions)
+	cache, ok := options.Credentials.(credentialsInvalidator)
+	if !ok {
+		lg.debugLogger("cwlogger: unable to refresh credentials that aren't cached")
+		return false
+	}
+	lg.debugLogger("cwlogger: refreshing expired credentials")
+	cache.Invalidate()
+	return true
+}
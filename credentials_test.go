@@ -0,0 +1,73 @@
+package cwlogger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// expiringClient fails the first PutLogEvents call as if its credentials had
+// expired.
+type expiringClient struct {
+	*mockClient
+	credentials *aws.CredentialsCache
+	expired     bool
+}
+
+func (c *expiringClient) Options() cloudwatchlogs.Options {
+	return cloudwatchlogs.Options{Credentials: c.credentials}
+}
+
+func (c *expiringClient) PutLogEvents(ctx context.Context, params *cloudwatchlogs.PutLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutLogEventsOutput, error) {
+	c.mu.Lock()
+	expired := !c.expired
+	c.expired = true
+	c.mu.Unlock()
+	if expired {
+		return nil, &smithy.GenericAPIError{Code: "ExpiredTokenException", Message: "The security token included in the request is expired"}
+	}
+	return c.mockClient.PutLogEvents(ctx, params, optFns...)
+}
+
+func TestExpiredCredentialsAreRefreshed(t *testing.T) {
+	withoutJitter(t, time.Millisecond)
+
+	var retrievals int
+	credentials := aws.NewCredentialsCache(aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		retrievals++
+		return aws.Credentials{AccessKeyID: "key", SecretAccessKey: "secret", CanExpire: true, Expires: time.Now().Add(time.Hour)}, nil
+	}))
+	_, err := credentials.Retrieve(context.Background())
+	assert.NoError(t, err)
+
+	client := &expiringClient{mockClient: new(mockClient), credentials: credentials}
+	var reported []error
+	logger, err := New(&Config{
+		Client:        client,
+		LogGroupName:  "test",
+		LogStreamName: "stream",
+		ErrorReporter: func(err error) {
+			reported = append(reported, err)
+		},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	logger.Log(time.Now(), "message")
+	logger.Close()
+
+	assert.Equal(t, []string{"message"}, client.messages["stream"])
+	assert.Empty(t, reported)
+	assert.EqualValues(t, 1, logger.Stats().BatchesRetried)
+
+	// The cached credentials were invalidated, so they are retrieved again.
+	_, err = credentials.Retrieve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, retrievals)
+}
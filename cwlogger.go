@@ -4,60 +4,422 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
-	"github.com/sirupsen/logrus"
 )
 
 // The Config for the Logger.
 type Config struct {
-	// The Amazon CloudWatch Logs client created with the AWS SDK for Go.
-	// Required.
-	Client *cloudwatchlogs.Client
+	// The Amazon CloudWatch Logs client created with the AWS SDK for Go, or
+	// any other implementation of CloudWatchLogsAPI. Required.
+	Client CloudWatchLogsAPI
 
 	// The name of the log group to write logs into. Required.
 	LogGroupName string
 
 	// An optional function to report errors that couldn't be automatically
 	// handled during a PutLogEvents API call and caused a log events to be
-	// dropped.
+	// dropped. Dropped batches are reported as a *DroppedBatchError.
+	//
+	// ErrorReporter receives the Err of each ErrorEvent passed to OnError,
+	// except those in the PhaseRetry phase.
 	ErrorReporter func(err error)
 
+	// An optional function to report errors along with the phase of writing
+	// logs they occurred in, the log stream, and the number of log events
+	// affected. Unlike ErrorReporter, it's also passed each failed attempt to
+	// write a batch that is retried. Both are called if set.
+	OnError func(ev ErrorEvent)
+
+	// An optional function called after every successful PutLogEvents API
+	// call with the number of log events and bytes written, as counted by
+	// CloudWatch Logs.
+	SuccessReporter func(events int, bytes int)
+
+	// An optional function to receive diagnostic messages, such as recoveries
+	// from sequence token errors. Diagnostic messages are discarded by default.
+	DebugLogger func(format string, v ...interface{})
+
 	// An optional log group retention time in days. This value is only taken into
-	// account when creating a log group that does not yet exist. Set to 0
-	// (default) for no retention policy. Refer to the PutRetentionPolicy API
-	// documentation for valid values.
+	// account when creating a log group that does not yet exist, unless
+	// EnforceRetention is set. Set to 0 (default) for no retention policy.
+	// Refer to the PutRetentionPolicy API documentation for valid values; New
+	// returns ErrInvalidRetention for any other value.
 	Retention int
+
+	// Optionally apply the Retention to the log group even if it already
+	// exists, so that changes to the Retention take effect. Ignored if
+	// AccountID is set. With AssumeLogGroupExists, the Retention is applied
+	// without creating the log group, and failures to apply it, for example
+	// for lack of permission, are reported to the ErrorReporter instead of
+	// failing New.
+	EnforceRetention bool
+
+	// An optional maximum time to wait after a log message is enqueued before
+	// sending the batch it belongs to, even if the batch is not full. Defaults
+	// to 1 second.
+	FlushInterval time.Duration
+
+	// An optional name of a single log stream to write all logs into. The log
+	// stream is created if it doesn't yet exist, or resumed from its current
+	// sequence token if it does. When set, no additional log streams are
+	// created in response to throttling. By default, log streams are given
+	// random names and created as needed.
+	LogStreamName string
+
+	// An optional number of log streams to create up front, across which
+	// batches are distributed. Defaults to 1. Ignored if LogStreamName is set.
+	Streams int
+
+	// An optional maximum number of log streams to write to at once, to stay
+	// within the CloudWatch Logs quotas under sustained throttling. Beyond it,
+	// no additional log streams are created in response to throttling, and
+	// throttled batches are retried on the existing log streams instead.
+	// Defaults to 50.
+	MaxStreams int
+
+	// An optional maximum number of log streams to write to with LogToStream.
+	// Each has a queue, batches, and goroutines of its own until the Logger is
+	// closed, so log messages to further log streams are dropped, with
+	// ErrTooManyStreams reported to the ErrorReporter. Defaults to 100.
+	MaxPinnedStreams int
+
+	// An optional maximum number of log messages waiting to be batched.
+	// Defaults to 10,000.
+	MaxQueueSize int
+
+	// An optional policy for Log to follow when the queue of log messages
+	// waiting to be batched is full. Defaults to Block.
+	DropPolicy DropPolicy
+
+	// An optional maximum number of times to retry writing a batch that failed
+	// with a retryable error, waiting with exponential backoff between
+	// attempts. Defaults to 5. Set to a negative value to disable retries.
+	MaxRetries int
+
+	// An optional function deciding what to do with a batch that failed to be
+	// written with err, for example to drop batches failing with an error that
+	// is retried by default. Errors are passed as reported to the
+	// ErrorReporter, so API errors can be examined with errors.As as an Error.
+	// Defaults to DefaultRetryClassifier.
+	RetryClassifier func(err error) RetryDecision
+
+	// An optional ARN of the KMS key used to encrypt the log group. Like
+	// Retention, this value is only taken into account when creating a log
+	// group that does not yet exist.
+	KMSKeyID string
+
+	// Optional tags to apply to the log group. Like Retention, these are only
+	// applied when creating a log group that does not yet exist; the tags of
+	// an existing log group are left untouched.
+	Tags map[string]string
+
+	// Optionally omit the sequence token from PutLogEvents calls. CloudWatch
+	// Logs no longer requires sequence tokens and ignores them in most regions,
+	// so they only need to be tracked when writing to regions that still
+	// enforce them. Defaults to false, which sends sequence tokens.
+	DisableSequenceToken bool
+
+	// An optional function that returns the name of the log stream to create
+	// for the given zero-based stream index, which counts every log stream the
+	// Logger has written to, including rotated ones. Defaults to a random
+	// prefix shared by all streams of the Logger, followed by a dot and the
+	// index. Ignored if LogStreamName is set.
+	StreamNameFunc func(index int) string
+
+	// An optional number of random bytes in the default log stream name
+	// prefix, which is hex encoded to twice as many characters. Must be at
+	// least 8 to avoid collisions between Loggers. Defaults to 32.
+	StreamPrefixLength int
+
+	// An optional number of random bytes to append, hex encoded and after a
+	// hyphen, to the LogStreamName or the names returned by StreamNameFunc,
+	// so that processes configured with the same names, such as the replicas
+	// of a deployment, write to log streams of their own instead of colliding.
+	// Defaults to appending nothing.
+	StreamNameSuffixLength int
+
+	// Optional functions to modify the client's options for every API call
+	// made by the Logger, for example to set an EndpointResolver pointing at
+	// LocalStack or a VPC endpoint.
+	ClientOptions []func(*cloudwatchlogs.Options)
+
+	// An optional maximum number of attempts the client's retryer makes for
+	// each API call, overriding the client's own setting. The Logger's retries
+	// layer on top of the retryer's: each attempt to write a batch counted
+	// towards MaxRetries, and reported to the Observer, may make up to
+	// MaxClientAttempts PutLogEvents requests. Only honored by clients created
+	// with the AWS SDK for Go.
+	MaxClientAttempts int
+
+	// An optional maximum time in the future that log messages may be
+	// timestamped. Later log messages are reported to the ErrorReporter as
+	// ErrEventTooNew instead of being enqueued. Defaults to 2 hours, the limit
+	// enforced by CloudWatch Logs.
+	MaxFutureSkew time.Duration
+
+	// An optional Observer to notify of the Logger's activity, for example to
+	// record metrics.
+	Observer Observer
+
+	// Optionally resume writing to the log stream of the log group that most
+	// recently received log events, rather than creating a new one, to avoid
+	// leaving behind many short-lived log streams across restarts. A new log
+	// stream is created if the log group has none. Ignored if LogStreamName is
+	// set.
+	ReuseRecentStream bool
+
+	// Optionally retire each log stream in favour of a newly created one once
+	// it has been written to for long enough, or has had enough bytes written
+	// to it, keeping individual log streams bounded. Defaults to never
+	// rotating. Ignored if LogStreamName is set.
+	RotateAfter Rotation
+
+	// Optionally replace a log stream with a newly created one once this many
+	// consecutive writes to it have failed, for example because its sequence
+	// token is stuck, so that it stops failing the batches sent to it while
+	// the other log streams keep working. Defaults to never replacing failing
+	// log streams. Ignored if LogStreamName is set.
+	QuarantineAfter int
+
+	// If set, Close deletes the log streams created by the Logger that no log
+	// events were written to, so that they don't linger as empty log streams,
+	// including those replaced because of RotateAfter or QuarantineAfter.
+	// Log streams that already existed are never deleted. The Client must
+	// implement LogStreamDeleter, otherwise an error is reported.
+	CleanupEmptyStreams bool
+
+	// Optional fields included in every log message written with
+	// LogWithFields, for example the service name or region.
+	DefaultFields map[string]interface{}
+
+	// An optional function returning fields to include in log messages
+	// written with LogCtxFields, extracted from the context, for example
+	// trace or request IDs.
+	ContextExtractor func(ctx context.Context) map[string]interface{}
+
+	// Optionally include the source of each log message written with
+	// LogWithFields or LogCtxFields, for consumers aggregating log events
+	// across log groups or accounts: the log group name as "logGroup", the
+	// region of the Client as "region", and, if the Logger writes to a single
+	// log stream, the log stream name as "logStream". These take precedence
+	// over fields of the same name.
+	IncludeSourceMetadata bool
+
+	// An optional Encoder for the log messages written with LogWithFields and
+	// LogCtxFields, for example NDJSONEncoder. Defaults to encoding them as
+	// JSON objects with json.Marshal.
+	Encoder Encoder
+
+	// An optional timeout for each call to the CloudWatch Logs API, so that a
+	// hung connection can't stall writing to a log stream indefinitely. Calls
+	// to PutLogEvents that time out are retried. Defaults to 30 seconds.
+	CallTimeout time.Duration
+
+	// An optional log class for the log group, applied only when the Logger
+	// creates it. Defaults to leaving the log class to CloudWatch Logs, which
+	// uses LogClassStandard.
+	LogClass LogClass
+
+	// An optional entity, such as a service, to associate the log events with
+	// in CloudWatch, for example for Application Signals. It is sent with
+	// every PutLogEvents call. Defaults to no entity.
+	Entity *types.Entity
+
+	// An optional ID of the AWS account the log group belongs to, for writing
+	// to a log group in another account, such as a central logging account,
+	// with a Client using credentials for a role assumed in that account. If
+	// set, New verifies that the log group exists in that account instead of
+	// creating it, and KMSKeyID, Tags, Retention, and LogClass are ignored.
+	AccountID string
+
+	// Optionally assume that the log group already exists instead of creating
+	// it, so that the Client doesn't need permission to create log groups.
+	// KMSKeyID, Tags, and LogClass are ignored, as is Retention unless
+	// EnforceRetention is set, and log groups deleted while the Logger is
+	// writing to them aren't recreated.
+	AssumeLogGroupExists bool
+
+	// Optionally check whether the log group exists with DescribeLogGroups,
+	// and only create it if it doesn't, so that the Client only needs
+	// permission to create log groups for new log groups. KMSKeyID, Tags,
+	// Retention, and LogClass are only applied to new log groups, as usual.
+	CheckLogGroup bool
+
+	// Optionally batch and validate log messages as usual, but skip all calls
+	// to the CloudWatch Logs API made to create the log group and log streams
+	// and to write log events, as if they had succeeded. Useful for exercising
+	// logging code paths in tests and CI without AWS credentials.
+	DryRun bool
+
+	// Optionally collapse identical consecutive log messages within a batch
+	// into a single log event, timestamped with the earliest of them, with the
+	// message suffixed by " (repeated N times)". Reduces ingestion costs for
+	// noisy applications.
+	CoalesceDuplicates bool
+
+	// An optional function applied to every log message before it is
+	// validated and enqueued, for example to redact secrets or add context.
+	MessageTransform func(s string) string
+
+	// Optionally allow empty and whitespace-only log messages to be enqueued.
+	// By default they're reported to the ErrorReporter as ErrEmptyMessage
+	// instead, as CloudWatch Logs rejects empty log messages, failing the whole
+	// batch.
+	AllowEmptyMessages bool
+
+	// Optionally write all batches to a single log stream, so that CloudWatch
+	// Logs displays a single chronological timeline, at the cost of throughput.
+	// Throttled writes are retried with backoff instead of creating additional
+	// log streams, and Streams is ignored.
+	OrderedSingleStream bool
+
+	// An optional limit on the rate at which log events are written across all
+	// log streams, in bytes per second as counted by CloudWatch Logs, to
+	// protect against runaway ingestion costs. Batches are held back once the
+	// limit is exceeded, applying backpressure to Log according to the
+	// DropPolicy. Retried batches count towards the limit again. Bursts of up
+	// to one second's worth of bytes are allowed. Defaults to no limit.
+	MaxBytesPerSecond int
+
+	// An optional limit on the rate at which log messages are enqueued, to
+	// protect against logging bugs flooding the log group. Log messages beyond
+	// the limit are dropped, with LogE returning ErrRateLimited. Bursts of up
+	// to one second's worth of log messages are allowed. Defaults to no limit.
+	MaxEventsPerSecond int
+
+	// Optionally stop writing to CloudWatch Logs for a while after repeated
+	// failures, dropping batches instead of retrying them. Defaults to
+	// retrying every batch regardless of earlier failures.
+	CircuitBreaker CircuitBreaker
+
+	// An optional writer, such as os.Stderr, to which log messages that can't
+	// be written to CloudWatch Logs are written instead of being lost, one
+	// line per log event prefixed with its timestamp. If set, New doesn't fail
+	// when the log group or log streams can't be created, but reports the
+	// error to the ErrorReporter, writes to the FallbackWriter and keeps trying
+	// to connect to CloudWatch Logs in the background. Batches dropped after
+	// failing to be written are also written to the FallbackWriter.
+	FallbackWriter io.Writer
+
+	// Optionally hold up to this many batches that have run out of retries
+	// while CloudWatch Logs is unavailable, instead of dropping them. While
+	// batches are held, later batches are held too rather than written, and
+	// the Logger checks with backoff whether the log group and log stream are
+	// available again, recreating them if they were deleted. Once they are,
+	// the held batches are written. Batches beyond the limit, and those still
+	// held when the Logger is closed, are dropped. Defaults to dropping
+	// batches once they've run out of retries.
+	OutageBufferSize int
+
+	// clock replaces the real clock in tests.
+	clock clock
 }
 
+// A LogClass is the log class of a log group, which determines the features
+// and pricing available to it.
+type LogClass string
+
+const (
+	// LogClassStandard supports all CloudWatch Logs features.
+	LogClassStandard LogClass = "STANDARD"
+
+	// LogClassInfrequentAccess has a lower ingestion price, but supports a
+	// subset of CloudWatch Logs features.
+	LogClassInfrequentAccess LogClass = "INFREQUENT_ACCESS"
+)
+
 // A Logger represents a single CloudWatch Logs log group.
 type Logger struct {
-	name          *string
-	svc           *cloudwatchlogs.Client
-	streams       *logStreams
-	prefix        string
-	batcher       *batcher
-	wg            sync.WaitGroup
-	done          chan bool
-	errorReporter func(err error)
-	retention     int
+	name            *string
+	svc             CloudWatchLogsAPI
+	clientOptions   []func(*cloudwatchlogs.Options)
+	streams         *logStreams
+	pinned          *pinnedStreams
+	streamName      string
+	streamNameFn    func(index int) string
+	cleanupEmpty    bool
+	maxStreams      int
+	singleStream    bool
+	limiter         *rateLimiter
+	eventLimiter    *eventLimiter
+	breaker         *breaker
+	fallback        io.Writer
+	cancelConnect   context.CancelFunc
+	connecting      chan struct{}
+	tokenLogged     int64 // when logTokenError last logged, in Unix nanoseconds
+	batcher         *batcher
+	dropPolicy      DropPolicy
+	maxRetries      int
+	classifier      func(err error) RetryDecision
+	outageBuffer    int
+	done            chan bool
+	onError         func(ev ErrorEvent)
+	flushErrors     *errorCollector
+	successReporter func(events int, bytes int)
+	debugLogger     func(format string, v ...interface{})
+	observer        Observer
+	rotation        Rotation
+	quarantine      int
+	defaultFields   map[string]interface{}
+	extractor       func(ctx context.Context) map[string]interface{}
+	sourceMetadata  bool
+	encoder         Encoder
+	region          string
+	transform       func(s string) string
+	allowEmpty      bool
+	callTimeout     time.Duration
+	retention       int
+	maxFutureSkew   time.Duration
+	kmsKeyID        string
+	tags            map[string]string
+	logClass        LogClass
+	entity          *types.Entity
+	noSeqToken      bool
+	dryRun          bool
+	assumeExists    bool
+	forceRetention  bool
+	clock           clock
+	stats           *stats
+	pending         *pendingEvents
+	closeOnce       sync.Once
+	drained         chan struct{}
+	closeMu         sync.RWMutex // held for writing while closing the batcher
+	closed          bool
+	arnMu           sync.Mutex
+	arn             string
 }
 
 // New creates a new Logger.
 //
-// Creates the log group if it doesn't yet exist, and one initial log stream for
+// Creates the log group if it doesn't yet exist, and the initial log streams for
 // writing logs into.
 //
 // Returns an error if the configuration is invalid, or if either the creation
-// of the log group or log stream fail.
+// of the log group or log stream fail, unless a FallbackWriter is configured.
 func New(config *Config) (*Logger, error) {
+	return NewWithContext(context.Background(), config)
+}
+
+// NewWithContext creates a new Logger like New, using ctx for the API calls
+// made to create the log group and initial log stream.
+//
+// If ctx is cancelled or its deadline expires before initialization completes,
+// the returned error wraps the context error.
+func NewWithContext(ctx context.Context, config *Config) (*Logger, error) {
 	if config.Client == nil {
 		return nil, errors.New("cwlogger: config missing required Client")
 	}
@@ -66,28 +428,198 @@ func New(config *Config) (*Logger, error) {
 		return nil, errors.New("cwlogger: config missing required LogGroupName")
 	}
 
-	errorReporter := noopErrorReporter
-	if config.ErrorReporter != nil {
-		errorReporter = config.ErrorReporter
+	if config.Retention != 0 && !validRetention(config.Retention) {
+		return nil, fmt.Errorf("%w: %d days", ErrInvalidRetention, config.Retention)
+	}
+
+	switch config.LogClass {
+	case "", LogClassStandard, LogClassInfrequentAccess:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidLogClass, config.LogClass)
+	}
+
+	successReporter := noopSuccessReporter
+	if config.SuccessReporter != nil {
+		successReporter = config.SuccessReporter
+	}
+
+	debugLogger := noopDebugLogger
+	if config.DebugLogger != nil {
+		debugLogger = config.DebugLogger
+	}
+
+	prefixLength := defaultStreamPrefixLength
+	if config.StreamPrefixLength != 0 {
+		if config.StreamPrefixLength < minStreamPrefixLength {
+			return nil, fmt.Errorf("cwlogger: StreamPrefixLength must be at least %d bytes", minStreamPrefixLength)
+		}
+		prefixLength = config.StreamPrefixLength
+	}
+
+	streamNameFn := config.StreamNameFunc
+	if streamNameFn == nil && config.LogStreamName == "" {
+		prefix, err := randomHex(prefixLength)
+		if err != nil {
+			return nil, fmt.Errorf("cwlogger: unable to generate log stream prefix: %w", err)
+		}
+		streamNameFn = func(index int) string {
+			return prefix + "." + strconv.Itoa(index)
+		}
+	}
+
+	streamName := config.LogStreamName
+	if config.StreamNameSuffixLength > 0 && (config.StreamNameFunc != nil || streamName != "") {
+		suffix, err := randomHex(config.StreamNameSuffixLength)
+		if err != nil {
+			return nil, fmt.Errorf("cwlogger: unable to generate log stream suffix: %w", err)
+		}
+		if streamName != "" {
+			streamName += "-" + suffix
+		} else {
+			nameFn := streamNameFn
+			streamNameFn = func(index int) string {
+				return nameFn(index) + "-" + suffix
+			}
+		}
+	}
+
+	flushInterval := defaultFlushInterval
+	if config.FlushInterval > 0 {
+		flushInterval = config.FlushInterval
+	}
+
+	maxQueueSize := defaultMaxQueueSize
+	if config.MaxQueueSize > 0 {
+		maxQueueSize = config.MaxQueueSize
+	}
+
+	var encoder Encoder = jsonEncoder{}
+	if config.Encoder != nil {
+		encoder = config.Encoder
+	}
+
+	classifier := DefaultRetryClassifier
+	if config.RetryClassifier != nil {
+		classifier = config.RetryClassifier
+	}
+
+	maxStreams := defaultMaxStreams
+	if config.MaxStreams > 0 {
+		maxStreams = config.MaxStreams
+	}
+
+	maxRetries := defaultMaxRetries
+	if config.MaxRetries != 0 {
+		maxRetries = config.MaxRetries
+	}
+
+	var observer Observer = noopObserver{}
+	if config.Observer != nil {
+		observer = config.Observer
+	}
+
+	maxFutureSkew := defaultMaxFutureSkew
+	if config.MaxFutureSkew > 0 {
+		maxFutureSkew = config.MaxFutureSkew
+	}
+
+	clk := config.clock
+	if clk == nil {
+		clk = realClock{}
+	}
+
+	callTimeout := defaultCallTimeout
+	if config.CallTimeout > 0 {
+		callTimeout = config.CallTimeout
+	}
+
+	clientOptions := config.ClientOptions
+	if config.MaxClientAttempts > 0 {
+		clientOptions = append(clientOptions[:len(clientOptions):len(clientOptions)], func(o *cloudwatchlogs.Options) {
+			o.RetryMaxAttempts = config.MaxClientAttempts
+		})
 	}
 
 	lg := &Logger{
-		errorReporter: errorReporter,
-		name:          &config.LogGroupName,
-		svc:           config.Client,
-		retention:     config.Retention,
-		prefix:        randomHex(32),
-		batcher:       newBatcher(),
-		done:          make(chan bool),
+		flushErrors:     new(errorCollector),
+		successReporter: successReporter,
+		debugLogger:     debugLogger,
+		observer:        observer,
+		rotation:        config.RotateAfter,
+		quarantine:      config.QuarantineAfter,
+		cleanupEmpty:    config.CleanupEmptyStreams,
+		defaultFields:   config.DefaultFields,
+		extractor:       config.ContextExtractor,
+		sourceMetadata:  config.IncludeSourceMetadata,
+		encoder:         encoder,
+		region:          clientRegion(config.Client, clientOptions),
+		transform:       config.MessageTransform,
+		allowEmpty:      config.AllowEmptyMessages,
+		callTimeout:     callTimeout,
+		name:            &config.LogGroupName,
+		svc:             config.Client,
+		clientOptions:   clientOptions,
+		retention:       config.Retention,
+		maxFutureSkew:   maxFutureSkew,
+		kmsKeyID:        config.KMSKeyID,
+		tags:            config.Tags,
+		logClass:        config.LogClass,
+		entity:          config.Entity,
+		noSeqToken:      config.DisableSequenceToken,
+		dryRun:          config.DryRun,
+		assumeExists:    config.AssumeLogGroupExists,
+		forceRetention:  config.EnforceRetention,
+		clock:           clk,
+		streamName:      streamName,
+		streamNameFn:    streamNameFn,
+		singleStream:    config.OrderedSingleStream || streamName != "",
+		batcher:         newBatcher(flushInterval, maxQueueSize, clk, config.CoalesceDuplicates),
+		dropPolicy:      config.DropPolicy,
+		maxStreams:      maxStreams,
+		maxRetries:      maxRetries,
+		classifier:      classifier,
+		outageBuffer:    config.OutageBufferSize,
+		done:            make(chan bool),
+		stats:           new(stats),
+		pending:         newPendingEvents(),
+	}
+	reportError := errorHandler(config.OnError, config.ErrorReporter)
+	lg.onError = func(ev ErrorEvent) {
+		lg.flushErrors.add(ev)
+		reportError(ev)
 	}
 
-	lg.streams = newLogStreams(lg)
+	if config.MaxBytesPerSecond > 0 {
+		lg.limiter = newRateLimiter(config.MaxBytesPerSecond, clk)
+	}
+	if config.MaxEventsPerSecond > 0 {
+		lg.eventLimiter = newEventLimiter(config.MaxEventsPerSecond, clk)
+	}
+	if config.CircuitBreaker.Failures > 0 {
+		lg.breaker = newBreaker(config.CircuitBreaker, clk)
+	}
 
-	if err := lg.createIfNotExists(); err != nil {
-		return nil, err
+	if config.FallbackWriter != nil {
+		lg.fallback = newSyncWriter(config.FallbackWriter)
 	}
-	if err := lg.streams.new(); err != nil {
-		return nil, err
+
+	lg.streams = newLogStreams(lg)
+	pinnedConfig := *config
+	pinnedConfig.FallbackWriter = lg.fallback
+	lg.pinned = newPinnedStreams(lg, pinnedConfig)
+
+	if err := lg.init(ctx, config); err != nil {
+		if lg.fallback == nil {
+			return nil, err
+		}
+		lg.onError(ErrorEvent{
+			Phase: PhaseCreate,
+			Err:   fmt.Errorf("cwlogger: writing to FallbackWriter until CloudWatch Logs is available: %w", err),
+		})
+		var connectCtx context.Context
+		connectCtx, lg.cancelConnect = context.WithCancel(context.Background())
+		lg.connecting = make(chan struct{})
+		go lg.reconnect(connectCtx, *config)
 	}
 
 	go lg.worker()
@@ -95,127 +627,883 @@ func New(config *Config) (*Logger, error) {
 	return lg, nil
 }
 
+// init creates or verifies the log group, and creates the initial log
+// streams, according to the config.
+func (lg *Logger) init(ctx context.Context, config *Config) error {
+	if err := lg.initLogGroup(ctx, config); err != nil {
+		return err
+	}
+	streams := lg.initialStreams(config)
+	if config.ReuseRecentStream && config.LogStreamName == "" && !config.DryRun {
+		resumed, err := lg.streams.resumeRecent(ctx)
+		if err != nil {
+			return err
+		}
+		if resumed {
+			streams--
+		}
+	}
+	for i := 0; i < streams; i++ {
+		if err := lg.streams.new(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// initLogGroup creates or verifies the log group according to the config.
+func (lg *Logger) initLogGroup(ctx context.Context, config *Config) error {
+	switch {
+	case config.DryRun:
+	case config.AssumeLogGroupExists:
+		if config.EnforceRetention {
+			if err := lg.putRetention(ctx); err != nil {
+				lg.onError(ErrorEvent{Phase: PhaseCreate, Err: err})
+			}
+		}
+	case config.AccountID != "":
+		if err := lg.verifyAccount(ctx, config.AccountID); err != nil {
+			return err
+		}
+	case config.CheckLogGroup:
+		if err := lg.checkIfNotExists(ctx); err != nil {
+			return err
+		}
+	default:
+		if err := lg.createIfNotExists(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const defaultMaxStreams = 50
+
+// initialStreams returns the number of log streams to start writing to, up to
+// the maximum.
+func (lg *Logger) initialStreams(config *Config) int {
+	if config.Streams > 1 && !lg.singleStream {
+		if config.Streams > lg.maxStreams {
+			return lg.maxStreams
+		}
+		return config.Streams
+	}
+	return 1
+}
+
 // Log enqueues a log message to be written to a log stream.
 //
-// The log message must be less than 1,048,550 bytes, and the time must not be
-// more than 2 hours in the future, 14 days in the past, or older than the
-// retention period of the log group.
+// The log message must be no more than 1,048,550 bytes and not empty, and the
+// time must not be more than 2 hours in the future, 14 days in the past, or
+// older than the retention period of the log group. Messages that are empty,
+// too large, too old, or too far in the future are reported to the
+// ErrorReporter as ErrEmptyMessage, ErrMessageTooLarge, ErrEventTooOld, or
+// ErrEventTooNew instead of being enqueued.
+//
+// If the queue of log messages waiting to be batched is full, Log blocks or
+// drops a message according to the configured DropPolicy. Log messages beyond
+// the MaxEventsPerSecond rate limit are dropped, with ErrRateLimited reported
+// at most once a second.
 //
 // This method is safe for concurrent access by multiple goroutines.
 func (lg *Logger) Log(t time.Time, s string) {
-	lg.wg.Add(1)
-	go func() {
-		lg.batcher.input <- types.InputLogEvent{
+	if err := lg.LogE(t, s); err != nil {
+		lg.reportLogError(err)
+	}
+}
+
+// reportLogError reports an error enqueuing a log message to the
+// ErrorReporter, reporting ErrRateLimited at most once a second.
+func (lg *Logger) reportLogError(err error) {
+	if err == ErrRateLimited && !lg.eventLimiter.report() {
+		return
+	}
+	lg.onError(ErrorEvent{Phase: PhaseEnqueue, Events: 1, Err: err})
+}
+
+// LogE is like Log, but returns ErrEmptyMessage, ErrMessageTooLarge,
+// ErrEventTooOld, or ErrEventTooNew without enqueuing the message if it would
+// be rejected, ErrDropped if the message is dropped by the DropNewest policy,
+// ErrRateLimited if it is dropped by the MaxEventsPerSecond rate limit, and
+// ErrClosed if the Logger is closed.
+//
+// This method is safe for concurrent access by multiple goroutines.
+func (lg *Logger) LogE(t time.Time, s string) error {
+	return lg.log(context.Background(), 0, t, s, nil)
+}
+
+// LogCtx is like Log, but abandons the log message if ctx is done before it is
+// accepted into the queue, for example while blocked on a full queue with the
+// Block policy. Abandoned log messages are reported to the ErrorReporter as
+// ctx.Err().
+//
+// This method is safe for concurrent access by multiple goroutines.
+func (lg *Logger) LogCtx(ctx context.Context, t time.Time, s string) {
+	if err := lg.log(ctx, 0, t, s, nil); err != nil {
+		lg.reportLogError(err)
+	}
+}
+
+// LogKeyed is like Log, but writes log messages with the same key to the same
+// log stream, rather than spreading them across the log streams, so that
+// related log messages, for example those of a request or tenant, are found
+// together. Keys are mapped to log streams by their hash, so each log stream
+// is shared by many keys, and adding log streams, with AddStream or in
+// response to throttling, changes which log stream a key maps to.
+//
+// This method is safe for concurrent access by multiple goroutines.
+func (lg *Logger) LogKeyed(key string, t time.Time, s string) {
+	if err := lg.log(context.Background(), lg.keySlot(key), t, s, nil); err != nil {
+		lg.reportLogError(err)
+	}
+}
+
+// keySlot returns the slot of the log events logged with key, which is one
+// more than the index of the log stream they're written to, so that log events
+// for the same log stream are batched together. It's zero when there's only
+// one log stream, for the log events to be batched with unkeyed ones.
+func (lg *Logger) keySlot(key string) int {
+	n := lg.StreamCount()
+	if n <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return 1 + int(h.Sum32()%uint32(n))
+}
+
+// LogSync is like LogE, but then blocks until the log message has been written
+// to CloudWatch Logs, returning the error that prevented it from being written,
+// if any. If ctx is done first LogSync returns ctx.Err(), and the log message is
+// abandoned like LogCtx if it hasn't yet been accepted into the queue, or still
+// written in the background otherwise.
+//
+// Log messages are written in batches, so LogSync typically blocks for up to
+// the FlushInterval.
+//
+// This method is safe for concurrent access by multiple goroutines.
+func (lg *Logger) LogSync(ctx context.Context, t time.Time, s string) error {
+	done := make(chan error, 1)
+	if err := lg.log(ctx, 0, t, s, done); err != nil {
+		return err
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// A LogEvent is a log message and its timestamp, for LogBatch.
+type LogEvent struct {
+	Time    time.Time
+	Message string
+}
+
+// LogBatch enqueues each of the log messages in events like Log, in order,
+// reporting those that can't be enqueued to the ErrorReporter. It is cheaper
+// than calling Log for each log message when there are many to enqueue at once.
+//
+// This method is safe for concurrent access by multiple goroutines, but log
+// messages enqueued concurrently by other goroutines may be interleaved with
+// the batch.
+func (lg *Logger) LogBatch(events []LogEvent) {
+	lg.closeMu.RLock()
+	defer lg.closeMu.RUnlock()
+
+	for _, event := range events {
+		err := ErrClosed
+		if !lg.closed {
+			err = lg.logLocked(context.Background(), 0, event.Time, event.Message, nil)
+		}
+		if err != nil {
+			lg.reportLogError(err)
+		}
+	}
+}
+
+// log enqueues a log message unless ctx is done first, delivering the outcome of
+// writing it on done if done is not nil and the log message is enqueued. The
+// slot is from keySlot for LogKeyed, or zero otherwise.
+func (lg *Logger) log(ctx context.Context, slot int, t time.Time, s string, done chan<- error) error {
+	lg.closeMu.RLock()
+	defer lg.closeMu.RUnlock()
+
+	if lg.closed {
+		return ErrClosed
+	}
+	return lg.logLocked(ctx, slot, t, s, done)
+}
+
+// logLocked is like log, but must be called with closeMu held for reading and
+// the Logger not closed.
+func (lg *Logger) logLocked(ctx context.Context, slot int, t time.Time, s string, done chan<- error) error {
+	if lg.transform != nil {
+		s = lg.transform(s)
+	}
+
+	if !lg.allowEmpty && strings.TrimSpace(s) == "" {
+		atomic.AddInt64(&lg.stats.eventsDropped, 1)
+		return ErrEmptyMessage
+	}
+
+	if len(s) > maxMessageSize {
+		atomic.AddInt64(&lg.stats.eventsDropped, 1)
+		return ErrMessageTooLarge
+	}
+
+	if err := lg.checkTime(t); err != nil {
+		atomic.AddInt64(&lg.stats.eventsDropped, 1)
+		return err
+	}
+
+	if lg.eventLimiter != nil && !lg.eventLimiter.allow() {
+		atomic.AddInt64(&lg.stats.eventsDropped, 1)
+		return ErrRateLimited
+	}
+
+	return lg.enqueue(ctx, logEvent{
+		InputLogEvent: types.InputLogEvent{
 			Message:   &s,
 			Timestamp: aws.Int64(t.UnixNano() / int64(time.Millisecond)),
+		},
+		done:  done,
+		nanos: t.UnixNano(),
+		slot:  slot,
+	})
+}
+
+// LogStruct JSON-encodes v as the log message and enqueues it like LogE,
+// returning an error without enqueuing anything if v can't be encoded.
+//
+// This method is safe for concurrent access by multiple goroutines.
+func (lg *Logger) LogStruct(t time.Time, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("cwlogger: unable to encode log message: %w", err)
+	}
+	return lg.LogE(t, string(b))
+}
+
+// LogWithFields enqueues a log message like LogStruct, as a JSON object with
+// the message and timestamp under the "message" and "timestamp" keys, alongside
+// the configured DefaultFields and the given fields. Fields take precedence over
+// DefaultFields of the same name, but can't replace the message or timestamp,
+// or the source metadata included with IncludeSourceMetadata. The object is
+// encoded with the configured Encoder.
+//
+// This method is safe for concurrent access by multiple goroutines.
+func (lg *Logger) LogWithFields(t time.Time, msg string, fields map[string]interface{}) error {
+	return lg.logFields(context.Background(), t, msg, fields)
+}
+
+// LogCtxFields enqueues a log message like LogWithFields, with the fields
+// returned by the configured ContextExtractor for ctx, and abandons it like
+// LogCtx if ctx is done before it is accepted into the queue. Without a
+// ContextExtractor, only the DefaultFields are included.
+//
+// This method is safe for concurrent access by multiple goroutines.
+func (lg *Logger) LogCtxFields(ctx context.Context, t time.Time, msg string) error {
+	var fields map[string]interface{}
+	if lg.extractor != nil {
+		fields = lg.extractor(ctx)
+	}
+	return lg.logFields(ctx, t, msg, fields)
+}
+
+// logFields encodes the log message and fields with the Encoder, then enqueues
+// it like log.
+func (lg *Logger) logFields(ctx context.Context, t time.Time, msg string, fields map[string]interface{}) error {
+	s, err := lg.encoder.Encode(lg.envelope(t, msg, fields))
+	if err != nil {
+		return fmt.Errorf("cwlogger: unable to encode log message: %w", err)
+	}
+	return lg.log(ctx, 0, t, s, nil)
+}
+
+// envelope returns the JSON object logged by LogWithFields.
+func (lg *Logger) envelope(t time.Time, msg string, fields map[string]interface{}) map[string]interface{} {
+	envelope := make(map[string]interface{}, len(lg.defaultFields)+len(fields)+2)
+	for k, v := range lg.defaultFields {
+		envelope[k] = v
+	}
+	for k, v := range fields {
+		envelope[k] = v
+	}
+	if lg.sourceMetadata {
+		envelope["logGroup"] = *lg.name
+		if lg.region != "" {
+			envelope["region"] = lg.region
 		}
-		lg.wg.Done()
-	}()
+		if lg.singleStream {
+			if names := lg.StreamNames(); len(names) == 1 {
+				envelope["logStream"] = names[0]
+			}
+		}
+	}
+	envelope["message"] = msg
+	envelope["timestamp"] = t
+	return envelope
+}
+
+// clientRegion returns the region the client sends requests to, with the
+// client options applied, or "" if the client doesn't expose its options.
+func clientRegion(client CloudWatchLogsAPI, optFns []func(*cloudwatchlogs.Options)) string {
+	options, _ := resolveOptions(client, optFns)
+	return options.Region
+}
+
+// resolveOptions returns the options of the client, with the client options
+// applied, and whether the client exposes its options.
+func resolveOptions(client CloudWatchLogsAPI, optFns []func(*cloudwatchlogs.Options)) (cloudwatchlogs.Options, bool) {
+	c, ok := client.(interface{ Options() cloudwatchlogs.Options })
+	if !ok {
+		return cloudwatchlogs.Options{}, false
+	}
+	options := c.Options()
+	for _, fn := range optFns {
+		fn(&options)
+	}
+	return options, true
 }
 
 // Close drains all enqueued log messages and writes them to CloudWatch Logs.
 // This method blocks until all pending log messages are written.
 //
 // The Logger is not meant to be used anymore after this method is called.
-// Doing so will result in a panic. Create a new Logger if you wish to write
-// more logs.
+// Log messages written after Close are rejected with ErrClosed, and further
+// calls to Close wait for the first to finish, returning immediately once it
+// has. Create a new Logger if you wish to write more logs.
 func (lg *Logger) Close() {
-	lg.wg.Wait()       // wait for all log entries to be accepted
-	lg.batcher.flush() // wait for all log entries to be batched
-	<-lg.done          // wait for all batches to be processed
-	lg.streams.flush() // wait for all batches to be sent to CloudWatch Logs
+	lg.CloseContext(context.Background())
+}
+
+// CloseContext is like Close, but gives up waiting once ctx is done, returning
+// ctx.Err(). Pending log messages continue to be written in the background on
+// a best-effort basis, but any that have not been written by the time the
+// process exits are lost.
+func (lg *Logger) CloseContext(ctx context.Context) error {
+	lg.closeOnce.Do(func() {
+		drained := make(chan struct{})
+		lg.drained = drained
+		go func() {
+			lg.closeMu.Lock()
+			lg.closed = true
+			lg.batcher.flush() // wait for all log entries to be batched
+			lg.closeMu.Unlock()
+
+			if lg.cancelConnect != nil {
+				lg.cancelConnect()
+				<-lg.connecting
+			}
+			close(lg.streams.closing)
+			<-lg.done          // wait for all batches to be processed
+			lg.streams.flush() // wait for all batches to be sent to CloudWatch Logs
+			if lg.cleanupEmpty {
+				lg.streams.deleteEmpty(context.Background())
+			}
+			lg.pinned.close()
+			close(drained)
+		}()
+	})
+
+	select {
+	case <-lg.drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Flush blocks until all enqueued log messages, including those enqueued with
+// LogToStream, have been written to CloudWatch Logs. Unlike Close, the Logger
+// can still be used afterwards.
+//
+// If other goroutines keep logging while Flush is waiting, Flush also waits for
+// their log messages to be written.
+func (lg *Logger) Flush() {
+	lg.FlushContext(context.Background())
+}
+
+// FlushContext is like Flush, but gives up waiting once ctx is done, returning
+// ctx.Err().
+func (lg *Logger) FlushContext(ctx context.Context) error {
+	lg.batcher.requestFlush()
+	lg.requestFlushPinned()
+	return lg.pending.wait(ctx)
+}
+
+// FlushAsync is like Flush, but returns immediately with a channel that
+// receives once the enqueued log messages have been written, when Flush would
+// have returned, and is then closed. This allows waiting for the flush in a
+// select statement, for example alongside a timeout.
+//
+// The channel receives the errors of the batches that failed to be written or
+// were dropped while the flush was waiting, joined with errors.Join, or nil if
+// there were none. These are the errors reported to the ErrorReporter in the
+// meantime, so they may include those of log messages enqueued after
+// FlushAsync was called.
+//
+// This method is safe for concurrent access by multiple goroutines.
+func (lg *Logger) FlushAsync() <-chan error {
+	flushed := make(chan error, 1)
+	errs := lg.flushErrors.start()
+	go func() {
+		lg.FlushContext(context.Background())
+		flushed <- lg.flushErrors.stop(errs)
+		close(flushed)
+	}()
+	return flushed
+}
+
+// WaitUntilIdle blocks until every log message accepted so far, including
+// those enqueued with LogToStream, has been written to CloudWatch Logs or
+// dropped, so that nothing is left in the queue, the batcher, or being written
+// to a log stream, or until ctx is done. Unlike Flush, it doesn't send the
+// batch being built early, but waits for it to fill up or for the flush
+// interval to elapse, so batching is the same as if it hadn't been called.
+// The Logger is not closed and can still be used afterwards.
+//
+// WaitUntilIdle is intended for tests, which can make assertions about what
+// was written, and about Stats, once it returns.
+//
+// This method is safe for concurrent access by multiple goroutines.
+func (lg *Logger) WaitUntilIdle(ctx context.Context) error {
+	return lg.pending.wait(ctx)
+}
+
+// AddStream creates an additional log stream and starts writing to it
+// alongside the others, for example to increase throughput during a bulk load.
+// It returns an error if the log stream can't be created, if the Logger
+// writes to a single log stream, or if it already writes to MaxStreams log
+// streams.
+//
+// This method is safe for concurrent access by multiple goroutines.
+func (lg *Logger) AddStream() error {
+	if lg.singleStream {
+		return errors.New("cwlogger: unable to add log streams when writing to a single log stream")
+	}
+	reply := make(chan error)
+	lg.streams.adds <- reply
+	return <-reply
+}
+
+// StreamCount returns the number of log streams the Logger writes to.
+//
+// This method is safe for concurrent access by multiple goroutines.
+func (lg *Logger) StreamCount() int {
+	lg.streams.mu.RLock()
+	defer lg.streams.mu.RUnlock()
+	return len(lg.streams.streams)
+}
+
+// LogGroupName returns the name of the log group the Logger writes to.
+func (lg *Logger) LogGroupName() string {
+	return *lg.name
+}
+
+// StreamNames returns the names of the log streams the Logger writes to.
+//
+// This method is safe for concurrent access by multiple goroutines.
+func (lg *Logger) StreamNames() []string {
+	return lg.streams.names()
+}
+
+// LogGroupARN returns the ARN of the log group the Logger writes to. The ARN
+// is looked up with DescribeLogGroups the first time this method is called.
+func (lg *Logger) LogGroupARN(ctx context.Context) (string, error) {
+	lg.arnMu.Lock()
+	defer lg.arnMu.Unlock()
+
+	if lg.arn != "" {
+		return lg.arn, nil
+	}
+
+	group, err := lg.describeLogGroup(ctx)
+	if err != nil {
+		return "", err
+	}
+	if group == nil {
+		return "", fmt.Errorf("Unable to find log group %q", *lg.name)
+	}
+	lg.arn = aws.ToString(group.Arn)
+	return lg.arn, nil
+}
+
+// describeLogGroup returns the log group the Logger writes to, or nil if it
+// doesn't exist.
+func (lg *Logger) describeLogGroup(ctx context.Context) (*types.LogGroup, error) {
+	input := &cloudwatchlogs.DescribeLogGroupsInput{
+		LogGroupNamePrefix: lg.name,
+	}
+	for {
+		callCtx, cancel := lg.callContext(ctx)
+		resp, err := lg.svc.DescribeLogGroups(callCtx, input, lg.clientOptions...)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("Unable to describe log group %q: %w", *lg.name, err)
+		}
+		for i, group := range resp.LogGroups {
+			if aws.ToString(group.LogGroupName) == *lg.name {
+				return &resp.LogGroups[i], nil
+			}
+		}
+		if resp.NextToken == nil {
+			return nil, nil
+		}
+		input.NextToken = resp.NextToken
+	}
+}
+
+// DeleteLogGroup closes the Logger like CloseContext, then deletes its log
+// group along with all of its log streams and log events. It is intended for
+// cleaning up after integration tests. Deleting a log group that doesn't exist
+// is not an error. The Client must implement LogGroupDeleter.
+func (lg *Logger) DeleteLogGroup(ctx context.Context) error {
+	if err := lg.CloseContext(ctx); err != nil {
+		return err
+	}
+	if lg.dryRun {
+		return nil
+	}
+
+	deleter, ok := lg.svc.(LogGroupDeleter)
+	if !ok {
+		return errors.New("cwlogger: client unable to delete log groups")
+	}
+	callCtx, cancel := lg.callContext(ctx)
+	defer cancel()
+	_, err := deleter.DeleteLogGroup(callCtx, &cloudwatchlogs.DeleteLogGroupInput{
+		LogGroupName: lg.name,
+	}, lg.clientOptions...)
+	if err != nil {
+		var notFoundErr *types.ResourceNotFoundException
+		if errors.As(err, &notFoundErr) {
+			return nil
+		}
+		return fmt.Errorf("Unable to delete log group %q: %w", *lg.name, err)
+	}
+	return nil
+}
+
+// HealthCheck verifies that CloudWatch Logs is reachable and that the Logger's
+// log streams can be described, which requires valid credentials and
+// permissions on the log group. It returns a descriptive error otherwise.
+func (lg *Logger) HealthCheck(ctx context.Context) error {
+	input := &cloudwatchlogs.DescribeLogStreamsInput{
+		LogGroupName: lg.name,
+		Limit:        aws.Int32(1),
+	}
+	if names := lg.StreamNames(); len(names) > 0 {
+		input.LogStreamNamePrefix = aws.String(names[0])
+	}
+
+	callCtx, cancel := lg.callContext(ctx)
+	defer cancel()
+	_, err := lg.svc.DescribeLogStreams(callCtx, input, lg.clientOptions...)
+	if err != nil {
+		return fmt.Errorf("cwlogger: health check failed for log group %q: %w", *lg.name, err)
+	}
+	return nil
+}
+
+const defaultCallTimeout = 30 * time.Second
+
+// callContext returns a context for a single call to the CloudWatch Logs API,
+// bounded by the CallTimeout.
+func (lg *Logger) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, lg.callTimeout)
 }
 
 func (lg *Logger) worker() {
 	for batch := range lg.batcher.output {
+		if lg.limiter != nil {
+			lg.limiter.wait(batchSize(batch.logEvents))
+		}
 		lg.streams.write(batch)
 	}
 	lg.done <- true
 }
 
-func (lg *Logger) createIfNotExists() error {
-	ctx := context.TODO()
+// retentionDays are the retention periods accepted by PutRetentionPolicy.
+var retentionDays = map[int]struct{}{
+	1: {}, 3: {}, 5: {}, 7: {}, 14: {}, 30: {}, 60: {}, 90: {}, 120: {},
+	150: {}, 180: {}, 365: {}, 400: {}, 545: {}, 731: {}, 1096: {}, 1827: {},
+	2192: {}, 2557: {}, 2922: {}, 3288: {}, 3653: {},
+}
+
+func validRetention(days int) bool {
+	_, ok := retentionDays[days]
+	return ok
+}
 
-	_, err := lg.svc.CreateLogGroup(ctx, &cloudwatchlogs.CreateLogGroupInput{
+func (lg *Logger) createIfNotExists(ctx context.Context) error {
+	input := &cloudwatchlogs.CreateLogGroupInput{
 		LogGroupName: lg.name,
+	}
+	if lg.kmsKeyID != "" {
+		input.KmsKeyId = aws.String(lg.kmsKeyID)
+	}
+	if len(lg.tags) > 0 {
+		input.Tags = lg.tags
+	}
+	if lg.logClass != "" {
+		input.LogGroupClass = types.LogGroupClass(lg.logClass)
+	}
+
+	err := lg.retryAborted(ctx, func() error {
+		callCtx, cancel := lg.callContext(ctx)
+		defer cancel()
+		_, err := lg.svc.CreateLogGroup(callCtx, input, lg.clientOptions...)
+		return err
 	})
 	if err != nil {
 		var existsErr *types.ResourceAlreadyExistsException
 		if errors.As(err, &existsErr) {
+			if lg.forceRetention {
+				return lg.putRetention(ctx)
+			}
 			return nil
 		}
 		return fmt.Errorf("Unable to create log group %q: %w", *lg.name, err)
 	}
+	return lg.putRetention(ctx)
+}
 
-	if lg.retention != 0 {
-		_, err = lg.svc.PutRetentionPolicy(ctx, &cloudwatchlogs.PutRetentionPolicyInput{
-			LogGroupName:    lg.name,
-			RetentionInDays: aws.Int32(int32(lg.retention)),
-		})
-		if err != nil {
-			return fmt.Errorf("Unable to set log group retention: %w", err)
+// putRetention sets the retention policy of the log group, if configured.
+func (lg *Logger) putRetention(ctx context.Context) error {
+	if lg.retention == 0 {
+		return nil
+	}
+	callCtx, cancel := lg.callContext(ctx)
+	_, err := lg.svc.PutRetentionPolicy(callCtx, &cloudwatchlogs.PutRetentionPolicyInput{
+		LogGroupName:    lg.name,
+		RetentionInDays: aws.Int32(int32(lg.retention)),
+	}, lg.clientOptions...)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("Unable to set log group retention: %w", err)
+	}
+	return nil
+}
+
+// checkIfNotExists creates the log group like createIfNotExists, but only if
+// DescribeLogGroups doesn't find it.
+func (lg *Logger) checkIfNotExists(ctx context.Context) error {
+	group, err := lg.describeLogGroup(ctx)
+	if err != nil {
+		return err
+	}
+	if group != nil {
+		if lg.forceRetention && aws.ToInt32(group.RetentionInDays) != int32(lg.retention) {
+			return lg.putRetention(ctx)
 		}
+		return nil
 	}
-	return err
+	return lg.createIfNotExists(ctx)
+}
+
+// verifyAccount returns an error unless the log group exists in the account
+// with the given ID.
+func (lg *Logger) verifyAccount(ctx context.Context, accountID string) error {
+	logGroupARN, err := lg.LogGroupARN(ctx)
+	if err != nil {
+		return err
+	}
+	parsed, err := arn.Parse(logGroupARN)
+	if err != nil {
+		return fmt.Errorf("Unable to parse log group ARN %q: %w", logGroupARN, err)
+	}
+	if parsed.AccountID != accountID {
+		return fmt.Errorf("cwlogger: log group %q belongs to account %s, not %s", *lg.name, parsed.AccountID, accountID)
+	}
+	return nil
 }
 
 type writeError struct {
-	batch  []types.InputLogEvent
+	batch  *pendingBatch
 	stream *logStream
 	err    error
 }
 
 type logStreams struct {
 	logger  *Logger
+	mu      sync.RWMutex // guards changes to streams
 	streams []*logStream
-	writers map[*logStream]chan []types.InputLogEvent
-	writes  chan []types.InputLogEvent
+	writers map[*logStream]chan *pendingBatch
+	writes  chan *pendingBatch
 	errors  chan *writeError
+	adds    chan chan error // requests for the coordinator to add a log stream
+	outage  outage
+	resumes chan bool     // from awaitRecovery, whether to replay the outage
+	closing chan struct{} // closed when the Logger is closed
 	wg      sync.WaitGroup
+	added   int // number of log streams written to, including rotated ones
+
+	// Log streams created by the Logger and since replaced, for deleteEmpty.
+	// Only kept with CleanupEmptyStreams. Guarded by mu.
+	retired []*logStream
 }
 
 func newLogStreams(lg *Logger) *logStreams {
 	streams := &logStreams{
 		logger:  lg,
 		streams: []*logStream{},
-		writers: make(map[*logStream]chan []types.InputLogEvent),
-		writes:  make(chan []types.InputLogEvent),
+		writers: make(map[*logStream]chan *pendingBatch),
+		writes:  make(chan *pendingBatch),
 		errors:  make(chan *writeError),
+		adds:    make(chan chan error),
+		resumes: make(chan bool),
+		closing: make(chan struct{}),
 	}
 	go streams.coordinator()
 	return streams
 }
 
-func (ls *logStreams) new() error {
-	name := ls.logger.prefix + "." + strconv.Itoa(len(ls.streams))
+func (ls *logStreams) new(ctx context.Context) error {
+	name := ls.logger.streamName
+	if name == "" {
+		name = ls.logger.streamNameFn(ls.added)
+	}
 	stream := &logStream{
 		name:   &name,
 		logger: ls.logger,
 	}
 
-	err := stream.create()
+	var err error
+	if ls.logger.streamName != "" && !ls.logger.dryRun {
+		err = stream.createOrResume(ctx)
+	} else {
+		err = stream.create(ctx)
+	}
 	if err != nil {
 		return err
 	}
 
+	ls.add(stream)
+	return nil
+}
+
+// full reports whether the Logger writes to the maximum number of log streams,
+// and mustn't create more.
+func (ls *logStreams) full() bool {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+	return len(ls.streams) >= ls.logger.maxStreams
+}
+
+// deleteEmpty deletes the log streams created by the Logger that no log events
+// were written to, including those it has since replaced, reporting errors
+// other than the log stream not existing.
+func (ls *logStreams) deleteEmpty(ctx context.Context) {
+	ls.mu.RLock()
+	streams := append(append([]*logStream(nil), ls.retired...), ls.streams...)
+	ls.mu.RUnlock()
+
+	deleter, ok := ls.logger.svc.(LogStreamDeleter)
+	for _, stream := range streams {
+		if !stream.created || atomic.LoadInt64(&stream.events) > 0 {
+			continue
+		}
+		if !ok {
+			ls.logger.onError(ErrorEvent{
+				Phase: PhaseDelete,
+				Err:   errors.New("cwlogger: client unable to delete log streams"),
+			})
+			return
+		}
+		callCtx, cancel := ls.logger.callContext(ctx)
+		_, err := deleter.DeleteLogStream(callCtx, &cloudwatchlogs.DeleteLogStreamInput{
+			LogGroupName:  ls.logger.name,
+			LogStreamName: stream.name,
+		}, ls.logger.clientOptions...)
+		cancel()
+		var notFoundErr *types.ResourceNotFoundException
+		if err != nil && !errors.As(err, &notFoundErr) {
+			ls.logger.onError(ErrorEvent{
+				Phase:  PhaseDelete,
+				Stream: *stream.name,
+				Err:    fmt.Errorf("cwlogger: unable to delete empty log stream %q: %w", *stream.name, err),
+			})
+			continue
+		}
+		ls.logger.debugLogger("cwlogger: deleted empty log stream %q", *stream.name)
+	}
+}
+
+// resumeRecent starts writing to the log stream of the log group that most
+// recently received log events, returning false if the log group has no log
+// streams.
+func (ls *logStreams) resumeRecent(ctx context.Context) (bool, error) {
+	ctx, cancel := ls.logger.callContext(ctx)
+	defer cancel()
+	resp, err := ls.logger.svc.DescribeLogStreams(
+		ctx,
+		&cloudwatchlogs.DescribeLogStreamsInput{
+			LogGroupName: ls.logger.name,
+			OrderBy:      types.OrderByLastEventTime,
+			Descending:   aws.Bool(true),
+			Limit:        aws.Int32(1),
+		},
+		ls.logger.clientOptions...,
+	)
+	if err != nil {
+		return false, fmt.Errorf("Unable to describe log streams: %w", err)
+	}
+	if len(resp.LogStreams) == 0 {
+		return false, nil
+	}
+
+	recent := resp.LogStreams[0]
+	ls.add(&logStream{
+		name:          recent.LogStreamName,
+		logger:        ls.logger,
+		sequenceToken: recent.UploadSequenceToken,
+	})
+	return true, nil
+}
+
+// add starts writing to a log stream that exists in CloudWatch Logs.
+func (ls *logStreams) add(stream *logStream) {
+	ls.mu.Lock()
 	ls.streams = append(ls.streams, stream)
-	ls.writers[stream] = make(chan []types.InputLogEvent)
-	go ls.writer(stream)
+	ls.mu.Unlock()
+	atomic.AddInt64(&ls.logger.stats.currentStreams, 1)
+	ls.start(stream)
+}
 
-	return nil
+// start starts the writer for a log stream.
+func (ls *logStreams) start(stream *logStream) {
+	ls.added++
+	stream.started = ls.logger.clock.Now()
+	batches := make(chan *pendingBatch)
+	ls.writers[stream] = batches
+	go ls.writer(stream, batches)
 }
 
-func (ls *logStreams) write(b []types.InputLogEvent) {
+// write blocks until the batch has been handed to the coordinator, which in turn
+// blocks until a log stream is available to write it. This keeps the number of
+// batches in flight bounded, and applies backpressure to the batcher.
+func (ls *logStreams) write(b *pendingBatch) {
 	ls.wg.Add(1)
-	go func() {
-		ls.writes <- b
-	}()
+	ls.writes <- b
+}
+
+// resend sends a batch that has already been sent to be written again, once
+// the MaxBytesPerSecond rate limit allows, as the worker does for new batches.
+func (ls *logStreams) resend(b *pendingBatch) {
+	if ls.logger.limiter != nil {
+		ls.logger.limiter.wait(batchSize(b.logEvents))
+	}
+	ls.writes <- b
 }
 
-func (ls *logStreams) writer(stream *logStream) {
-	for batch := range ls.writers[stream] {
+func (ls *logStreams) writer(stream *logStream, batches chan *pendingBatch) {
+	for batch := range batches {
 		batch := batch // create new instance of batch for the goroutine
-		err := stream.write(batch)
+		rejected, err := stream.write(batch.logEvents)
 		if err != nil {
 			go func() {
 				ls.errors <- &writeError{
@@ -225,6 +1513,16 @@ func (ls *logStreams) writer(stream *logStream) {
 				}
 			}()
 		} else {
+			size := batchSize(batch.logEvents)
+			atomic.AddInt64(&ls.logger.stats.batchesSent, 1)
+			atomic.AddInt64(&ls.logger.stats.bytesSent, int64(size))
+			atomic.AddInt64(&stream.bytesWritten, int64(size))
+			atomic.AddInt64(&stream.events, int64(len(batch.logEvents)))
+			atomic.StoreInt64(&stream.failures, 0)
+			ls.logger.breaker.success()
+			ls.logger.successReporter(len(batch.logEvents), size)
+			ls.logger.pending.add(-batch.events())
+			batch.finishWritten(rejected)
 			ls.wg.Done()
 		}
 	}
@@ -235,27 +1533,182 @@ func (ls *logStreams) coordinator() {
 	for {
 		select {
 		case batch := <-ls.writes:
-			i = (i + 1) % len(ls.streams)
-			stream := ls.streams[i]
+			if !ls.logger.breaker.allow() {
+				ls.discard(batch, ErrCircuitOpen)
+				continue
+			}
+			if ls.outage.active {
+				ls.hold(batch, ErrUnavailable)
+				continue
+			}
+			if len(ls.streams) == 0 {
+				if ls.logger.fallback != nil {
+					// Still connecting to CloudWatch Logs in the background.
+					ls.discard(batch, ErrUnavailable)
+					continue
+				}
+				if err := ls.ensureStream(); err != nil {
+					ls.drop(batch, "", fmt.Errorf("cwlogger: unable to create log stream: %w", err))
+					continue
+				}
+			}
+			j := (batch.slot - 1) % len(ls.streams) // the keyed log stream
+			if batch.slot == 0 {
+				i = (i + 1) % len(ls.streams)
+				j = i
+			}
+			if ls.logger.streamName == "" && ls.logger.rotation.due(ls.streams[j], ls.logger.clock.Now()) {
+				ls.rotate(j)
+			}
+			stream := ls.streams[j]
 			ls.writers[stream] <- batch
 		case err := <-ls.errors:
 			ls.handle(err)
+		case reply := <-ls.adds:
+			if ls.full() {
+				reply <- fmt.Errorf("cwlogger: unable to add log streams beyond the maximum of %d", ls.logger.maxStreams)
+				continue
+			}
+			reply <- ls.new(context.Background())
+		case recovered := <-ls.resumes:
+			ls.endOutage(recovered)
+		}
+	}
+}
+
+// ensureStream creates a log stream for the coordinator to write to, retrying
+// with backoff up to maxRetries times, or until the Logger is closed, and
+// returning the last error if it doesn't succeed.
+func (ls *logStreams) ensureStream() error {
+	for attempts := 1; ; attempts++ {
+		err := ls.new(context.Background())
+		if err == nil {
+			return nil
+		}
+		ls.logger.debugLogger("cwlogger: unable to create log stream: %v", err)
+		if attempts > ls.logger.maxRetries {
+			return err
+		}
+		select {
+		case <-time.After(retryDelay(attempts)):
+		case <-ls.closing:
+			return err
 		}
 	}
 }
 
 func (ls *logStreams) handle(writeErr *writeError) {
-	if isErrorCode(writeErr.err, errCodeThrottlingException) {
-		ls.new()
+	if ls.logger.breaker.failure() {
+		ls.logger.onError(ErrorEvent{
+			Phase:  PhaseWrite,
+			Stream: *writeErr.stream.name,
+			Err: fmt.Errorf("%w after %d consecutive failures: %w",
+				ErrCircuitOpen, ls.logger.breaker.config.Failures, writeErr.err),
+		})
+	}
+	if ls.logger.breaker.cooling() {
+		ls.discard(writeErr.batch, writeErr.err)
+		return
+	}
+
+	failures := atomic.AddInt64(&writeErr.stream.failures, 1)
+	if ls.logger.quarantine > 0 && failures >= int64(ls.logger.quarantine) && ls.logger.streamName == "" {
+		ls.quarantine(writeErr.stream)
+	}
+
+	decision := ls.logger.classifier(writeErr.err)
+	if decision == NewStream && !ls.logger.singleStream && !ls.full() {
+		ls.new(context.Background())
+	}
+	if decision == RefreshCredentials {
+		ls.logger.refreshCredentials()
 	}
-	if shouldRetry(writeErr.err) {
+	retry := decision != Drop
+	if retry && isErrorCode(writeErr.err, errCodeResourceNotFoundException) {
+		retry = ls.recreate(writeErr.stream)
+	}
+	batch := writeErr.batch
+	batch.attempts++
+	if retry && batch.attempts <= ls.logger.maxRetries {
+		ls.logger.onError(ErrorEvent{
+			Phase:  PhaseRetry,
+			Stream: *writeErr.stream.name,
+			Events: batch.events(),
+			Err:    writeErr.err,
+		})
+		atomic.AddInt64(&ls.logger.stats.batchesRetried, 1)
+		delay := retryDelay(batch.attempts)
 		go func() {
-			ls.writes <- writeErr.batch
+			time.Sleep(delay)
+			ls.resend(batch)
 		}()
+	} else if ls.logger.outageBuffer > 0 && decision != Drop {
+		ls.hold(batch, writeErr.err)
 	} else {
-		ls.wg.Done()
-		ls.logger.errorReporter(writeErr.err)
+		ls.drop(batch, *writeErr.stream.name, writeErr.err)
+	}
+}
+
+// drop discards a batch that failed to be written to the named log stream, or
+// "" if it wasn't written to one, reporting it as a *DroppedBatchError.
+func (ls *logStreams) drop(batch *pendingBatch, stream string, err error) {
+	ls.logger.onError(ErrorEvent{
+		Phase:  PhaseDrop,
+		Stream: stream,
+		Events: batch.events(),
+		Err: &DroppedBatchError{
+			Err:       err,
+			LogEvents: batch.logEvents,
+		},
+	})
+	ls.discard(batch, err)
+}
+
+// discard drops a batch that won't be written, writing it to the
+// FallbackWriter if set, and delivering err to the log events waiting on it.
+// Discarding a batch lets Close, Flush and LogSync return, so any error about
+// it must be reported first.
+func (ls *logStreams) discard(batch *pendingBatch, err error) {
+	ls.logger.writeFallback(batch.logEvents)
+	atomic.AddInt64(&ls.logger.stats.eventsDropped, int64(batch.events()))
+	ls.logger.pending.add(-batch.events())
+	batch.finish(err)
+	ls.wg.Done()
+}
+
+// recreate creates the log group and log stream again after either was deleted
+// while the Logger was writing to it, returning whether it succeeded. The
+// sequence token of the deleted log stream, which the new log stream doesn't
+// accept, is forgotten by the writer, which owns it, before its next write.
+func (ls *logStreams) recreate(stream *logStream) bool {
+	ctx := context.Background()
+	if !ls.logger.assumeExists {
+		if err := ls.logger.createIfNotExists(ctx); err != nil {
+			ls.logger.debugLogger("cwlogger: unable to recreate log group: %v", err)
+			return false
+		}
 	}
+	if err := stream.createStream(ctx); err != nil {
+		var existsErr *types.ResourceAlreadyExistsException
+		if !errors.As(err, &existsErr) {
+			ls.logger.debugLogger("cwlogger: unable to recreate log stream %q: %v", *stream.name, err)
+			return false
+		}
+	}
+	atomic.StoreInt32(&stream.staleToken, 1)
+	ls.logger.debugLogger("cwlogger: recreated log stream %q", *stream.name)
+	return true
+}
+
+func (ls *logStreams) names() []string {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	names := make([]string, len(ls.streams))
+	for i, stream := range ls.streams {
+		names[i] = *stream.name
+	}
+	return names
 }
 
 func (ls *logStreams) flush() {
@@ -266,61 +1719,245 @@ type logStream struct {
 	name          *string
 	logger        *Logger
 	sequenceToken *string
+	started       time.Time
+	bytesWritten  int64 // accessed atomically
+	events        int64 // log events written, accessed atomically
+	created       bool  // by the Logger, rather than already existing
+	failures      int64 // consecutive failed writes, accessed atomically
+	staleToken    int32 // set when the log stream is recreated, accessed atomically
 }
 
-func (ls *logStream) create() error {
-	_, err := ls.logger.svc.CreateLogStream(
-		context.TODO(),
-		&cloudwatchlogs.CreateLogStreamInput{
-			LogGroupName:  ls.logger.name,
-			LogStreamName: ls.name,
-		})
+// create creates the log stream. If it already exists, for example because
+// another process sharing the log stream name created it first, create resumes
+// writing to it from its current sequence token instead.
+func (ls *logStream) create(ctx context.Context) error {
+	err := ls.createStream(ctx)
+	if err == nil {
+		ls.created = !ls.logger.dryRun
+	}
+	var existsErr *types.ResourceAlreadyExistsException
+	if !errors.As(err, &existsErr) {
+		return err
+	}
+
+	ls.logger.debugLogger("cwlogger: log stream %q already exists", *ls.name)
+	return ls.bootstrapToken(ctx)
+}
+
+// bootstrapToken sets the sequence token of a log stream that already exists
+// to its current upload sequence token, so that the first write to it doesn't
+// fail with an InvalidSequenceTokenException.
+func (ls *logStream) bootstrapToken(ctx context.Context) error {
+	if ls.logger.noSeqToken {
+		return nil
+	}
+	existing, err := ls.describe(ctx)
+	if err != nil {
+		return fmt.Errorf("Unable to describe log stream %q: %w", *ls.name, err)
+	}
+	if existing != nil {
+		ls.sequenceToken = existing.UploadSequenceToken
+	}
+	return nil
+}
+
+// createStream calls CreateLogStream.
+func (ls *logStream) createStream(ctx context.Context) error {
+	if ls.logger.dryRun {
+		return nil
+	}
+
+	return ls.logger.retryAborted(ctx, func() error {
+		ctx, cancel := ls.logger.callContext(ctx)
+		defer cancel()
+		_, err := ls.logger.svc.CreateLogStream(
+			ctx,
+			&cloudwatchlogs.CreateLogStreamInput{
+				LogGroupName:  ls.logger.name,
+				LogStreamName: ls.name,
+			},
+			ls.logger.clientOptions...,
+		)
+		return err
+	})
+}
 
-	return err
+// createOrResume resumes writing to the log stream from its current sequence
+// token if it already exists, or creates it otherwise.
+func (ls *logStream) createOrResume(ctx context.Context) error {
+	existing, err := ls.describe(ctx)
+	if err != nil {
+		return fmt.Errorf("Unable to describe log stream %q: %w", *ls.name, err)
+	}
+	if existing == nil {
+		return ls.create(ctx)
+	}
+	ls.sequenceToken = existing.UploadSequenceToken
+	return nil
 }
 
-func (ls *logStream) write(b []types.InputLogEvent) error {
-	fmt.Printf("In put with %d events\b", len(b))
+// describe returns the log stream's description, or nil if it doesn't exist.
+func (ls *logStream) describe(ctx context.Context) (*types.LogStream, error) {
+	input := &cloudwatchlogs.DescribeLogStreamsInput{
+		LogGroupName:        ls.logger.name,
+		LogStreamNamePrefix: ls.name,
+	}
+	for {
+		callCtx, cancel := ls.logger.callContext(ctx)
+		resp, err := ls.logger.svc.DescribeLogStreams(callCtx, input, ls.logger.clientOptions...)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		for i := range resp.LogStreams {
+			if aws.ToString(resp.LogStreams[i].LogStreamName) == *ls.name {
+				return &resp.LogStreams[i], nil
+			}
+		}
+		if resp.NextToken == nil {
+			return nil, nil
+		}
+		input.NextToken = resp.NextToken
+	}
+}
 
+// write writes a batch of log events to the log stream with PutLogEvents,
+// returning the log events CloudWatch Logs rejected if the call succeeded.
+func (ls *logStream) write(b []types.InputLogEvent) ([]rejection, error) {
+	if atomic.CompareAndSwapInt32(&ls.staleToken, 1, 0) {
+		ls.sequenceToken = nil
+	}
 	input := cloudwatchlogs.PutLogEventsInput{
 		LogGroupName:  ls.logger.name,
 		LogStreamName: ls.name,
 		LogEvents:     b,
-		SequenceToken: ls.sequenceToken,
+		Entity:        ls.logger.entity,
+	}
+	if !ls.logger.noSeqToken {
+		input.SequenceToken = ls.sequenceToken
+	}
+	if ls.logger.dryRun {
+		return nil, nil
 	}
 
+	ctx, cancel := ls.logger.callContext(context.Background())
+	defer cancel()
+	start := time.Now()
 	resp, err := ls.logger.svc.PutLogEvents(
-		context.TODO(),
+		ctx,
 		&input,
+		ls.logger.clientOptions...,
 	)
+	ls.logger.observer.PutLogEvents(len(b), batchSize(b), time.Since(start), err)
 	if err != nil {
 		var invalidToken *types.InvalidSequenceTokenException
-		if errors.As(err, &invalidToken) {
-			logrus.Warnf("Received invalid token sequence exception")
+		var accepted *types.DataAlreadyAcceptedException
+		switch {
+		case errors.As(err, &invalidToken):
+			atomic.AddInt64(&ls.logger.stats.invalidTokenRecoveries, 1)
+			ls.logger.logTokenError("cwlogger: invalid sequence token for log stream %q", *ls.name)
 			if invalidToken.ExpectedSequenceToken != nil {
 				ls.sequenceToken = invalidToken.ExpectedSequenceToken
 			}
-		} else {
-			var seen *types.DataAlreadyAcceptedException
-			if errors.As(err, &seen) {
-				logrus.Warnf("Received already accepted ")
-				if seen.ExpectedSequenceToken != nil {
-					ls.sequenceToken = seen.ExpectedSequenceToken
-				}
-			} else {
-				panic("unknown error" + err.Error())
+		case errors.As(err, &accepted):
+			// The batch was written by an earlier attempt, so there is
+			// nothing left to do but resume from the expected token.
+			atomic.AddInt64(&ls.logger.stats.duplicateBatches, 1)
+			ls.logger.logTokenError("cwlogger: data already accepted by log stream %q", *ls.name)
+			if accepted.ExpectedSequenceToken != nil {
+				ls.sequenceToken = accepted.ExpectedSequenceToken
 			}
+			return nil, nil
 		}
-		return err
+		return nil, toError(err)
 	}
 
 	ls.sequenceToken = resp.NextSequenceToken
 
-	return nil
+	var rejected []rejection
+	if info := resp.RejectedLogEventsInfo; info != nil {
+		rejected = ls.reportRejected(info, len(b))
+	}
+	if info := resp.RejectedEntityInfo; info != nil {
+		ls.logger.debugLogger("cwlogger: entity rejected by log stream %q: %s", *ls.name, info.ErrorType)
+	}
+
+	return rejected, nil
+}
+
+// tokenLogInterval is the minimum time between diagnostic messages about
+// sequence token errors, which can be frequent when several processes write to
+// the same log stream.
+const tokenLogInterval = time.Minute
+
+// logTokenError passes a diagnostic message about a sequence token error to the
+// DebugLogger, unless one was passed within the last tokenLogInterval. The
+// errors are counted in Stats regardless.
+func (lg *Logger) logTokenError(format string, v ...interface{}) {
+	now := lg.clock.Now().UnixNano()
+	last := atomic.LoadInt64(&lg.tokenLogged)
+	if last != 0 && now-last < int64(tokenLogInterval) {
+		return
+	}
+	if atomic.CompareAndSwapInt64(&lg.tokenLogged, last, now) {
+		lg.debugLogger(format, v...)
+	}
+}
+
+// A rejection is a range of log events in a batch, from start up to but not
+// including end, that CloudWatch Logs rejected.
+type rejection struct {
+	start, end int
+	err        *RejectedLogEventsError
 }
 
-func randomHex(n int) string {
+// reportRejected reports the log events of a successful PutLogEvents call that
+// were nonetheless rejected by CloudWatch Logs, returning them.
+func (ls *logStream) reportRejected(info *types.RejectedLogEventsInfo, n int) []rejection {
+	var rejected []rejection
+	report := func(reason string, start, end int) {
+		count := end - start
+		if count <= 0 {
+			return
+		}
+		err := &RejectedLogEventsError{
+			Reason: reason,
+			Count:  count,
+		}
+		atomic.AddInt64(&ls.logger.stats.eventsDropped, int64(count))
+		ls.logger.onError(ErrorEvent{
+			Phase:  PhaseWrite,
+			Stream: *ls.name,
+			Events: count,
+			Err:    err,
+		})
+		rejected = append(rejected, rejection{start: start, end: end, err: err})
+	}
+
+	if info.TooNewLogEventStartIndex != nil {
+		report(RejectedTooNew, int(*info.TooNewLogEventStartIndex), n)
+	}
+	if info.TooOldLogEventEndIndex != nil {
+		report(RejectedTooOld, 0, int(*info.TooOldLogEventEndIndex))
+	}
+	if info.ExpiredLogEventEndIndex != nil {
+		report(RejectedExpired, 0, int(*info.ExpiredLogEventEndIndex))
+	}
+	return rejected
+}
+
+const (
+	defaultStreamPrefixLength = 32
+	minStreamPrefixLength     = 8
+)
+
+// randReader is the source of randomness for log stream name prefixes.
+var randReader io.Reader = rand.Reader
+
+func randomHex(n int) (string, error) {
 	b := make([]byte, n)
-	rand.Read(b)
-	return hex.EncodeToString(b)
+	if _, err := io.ReadFull(randReader, b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
@@ -2,7 +2,9 @@ package cwlogger
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sort"
 	"strconv"
@@ -22,6 +24,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -56,6 +59,427 @@ func TestCreatesGroupAndStream(t *testing.T) {
 	assert.True(t, logStreamCreated)
 }
 
+func TestCreatesConfiguredNumberOfStreams(t *testing.T) {
+	var streamNames []string
+	config := &Config{
+		LogGroupName: "test",
+		Streams:      3,
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "CreateLogStream" {
+			var data CreateLogStream
+			parseBody(r, &data)
+			streamNames = append(streamNames, data.LogStreamName)
+		}
+	})
+
+	if assert.Len(t, streamNames, 3) {
+		for i, name := range streamNames {
+			assert.True(t, strings.HasSuffix(name, "."+strconv.Itoa(i)), name)
+		}
+	}
+	assert.EqualValues(t, 3, logger.Stats().CurrentStreams)
+}
+
+func TestCreatesGroupWithKMSKey(t *testing.T) {
+	var data CreateLogGroup
+	config := &Config{
+		LogGroupName: "test",
+		KMSKeyID:     "arn:aws:kms:us-east-1:123456789012:key/abcd",
+	}
+
+	newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "CreateLogGroup" {
+			parseBody(r, &data)
+		}
+	})
+
+	if assert.NotNil(t, data.KmsKeyID) {
+		assert.Equal(t, "arn:aws:kms:us-east-1:123456789012:key/abcd", *data.KmsKeyID)
+	}
+}
+
+func TestCreatesGroupWithoutKMSKey(t *testing.T) {
+	var data CreateLogGroup
+
+	newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "CreateLogGroup" {
+			parseBody(r, &data)
+		}
+	})
+
+	assert.Equal(t, "test", data.LogGroupName)
+	assert.Nil(t, data.KmsKeyID)
+}
+
+func TestCreatesGroupWithLogClass(t *testing.T) {
+	var data CreateLogGroup
+	config := &Config{
+		LogGroupName: "test",
+		LogClass:     LogClassInfrequentAccess,
+	}
+
+	newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "CreateLogGroup" {
+			parseBody(r, &data)
+		}
+	})
+
+	if assert.NotNil(t, data.LogGroupClass) {
+		assert.Equal(t, "INFREQUENT_ACCESS", *data.LogGroupClass)
+	}
+}
+
+func TestCreatesGroupWithoutLogClass(t *testing.T) {
+	var data CreateLogGroup
+
+	newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "CreateLogGroup" {
+			parseBody(r, &data)
+		}
+	})
+
+	assert.Nil(t, data.LogGroupClass)
+}
+
+func TestConfigLogClass(t *testing.T) {
+	var calls int
+	logger, err := New(&Config{
+		Client: newClientWithServer(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+		}),
+		LogGroupName: "test",
+		LogClass:     "GLACIER",
+	})
+
+	assert.Nil(t, logger)
+	assert.True(t, errors.Is(err, ErrInvalidLogClass), "unexpected error: %v", err)
+	assert.Equal(t, 0, calls)
+}
+
+func TestCreatesGroupWithTags(t *testing.T) {
+	var data CreateLogGroup
+	config := &Config{
+		LogGroupName: "test",
+		Tags:         map[string]string{"team": "platform", "env": "prod"},
+	}
+
+	newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "CreateLogGroup" {
+			parseBody(r, &data)
+		}
+	})
+
+	assert.Equal(t, map[string]string{"team": "platform", "env": "prod"}, data.Tags)
+}
+
+func TestCreatesGroupWithEmptyTags(t *testing.T) {
+	var body string
+	config := &Config{
+		LogGroupName: "test",
+		Tags:         map[string]string{},
+	}
+
+	newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "CreateLogGroup" {
+			b, _ := ioutil.ReadAll(r.Body)
+			body = string(b)
+		}
+	})
+
+	assert.NotContains(t, body, "tags")
+}
+
+func TestStreamNameFunc(t *testing.T) {
+	var streamNames []string
+	config := &Config{
+		LogGroupName: "test",
+		Streams:      2,
+		StreamNameFunc: func(index int) string {
+			return "host-1/" + strconv.Itoa(index+1)
+		},
+	}
+
+	newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "CreateLogStream" {
+			var data CreateLogStream
+			parseBody(r, &data)
+			streamNames = append(streamNames, data.LogStreamName)
+		}
+	})
+
+	assert.Equal(t, []string{"host-1/1", "host-1/2"}, streamNames)
+}
+
+func TestStreamPrefixLength(t *testing.T) {
+	for _, tc := range []struct {
+		length   int
+		expected int
+	}{
+		{0, 64},
+		{8, 16},
+		{12, 24},
+	} {
+		config := &Config{
+			LogGroupName:       "test",
+			StreamPrefixLength: tc.length,
+		}
+
+		logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {})
+		prefix := strings.Split(logger.StreamNames()[0], ".")[0]
+		assert.Regexp(t, fmt.Sprintf("^[0-9a-f]{%d}$", tc.expected), prefix, "length %d", tc.length)
+		logger.Close()
+	}
+
+	logger, err := New(&Config{
+		Client:             newClientWithServer(func(w http.ResponseWriter, r *http.Request) {}),
+		LogGroupName:       "test",
+		StreamPrefixLength: 4,
+	})
+	assert.Nil(t, logger)
+	assert.EqualError(t, err, "cwlogger: StreamPrefixLength must be at least 8 bytes")
+}
+
+func TestStreamNameSuffixLength(t *testing.T) {
+	for _, config := range []Config{
+		{LogStreamName: "app"},
+		{StreamNameFunc: func(index int) string { return "app/" + strconv.Itoa(index) }},
+	} {
+		config.LogGroupName = "test"
+		config.StreamNameSuffixLength = 4
+
+		var names []string
+		for i := 0; i < 2; i++ {
+			cfg := config
+			cfg.Client = new(mockClient)
+			logger, err := New(&cfg)
+			if !assert.NoError(t, err) {
+				return
+			}
+			names = append(names, logger.StreamNames()...)
+			logger.Close()
+		}
+
+		if assert.Len(t, names, 2) {
+			assert.Regexp(t, "^app(/0)?-[0-9a-f]{8}$", names[0])
+			assert.Regexp(t, "^app(/0)?-[0-9a-f]{8}$", names[1])
+			assert.NotEqual(t, names[0], names[1])
+		}
+	}
+}
+
+func TestReportsCreatedResources(t *testing.T) {
+	var streamNames []string
+	var describeCalls int
+	config := &Config{
+		LogGroupName: "test",
+		Streams:      2,
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		switch action(r) {
+		case "CreateLogStream":
+			var data CreateLogStream
+			parseBody(r, &data)
+			streamNames = append(streamNames, data.LogStreamName)
+		case "DescribeLogGroups":
+			describeCalls++
+			w.Write([]byte(`
+				{
+					"logGroups": [
+						{"logGroupName": "test-other", "arn": "arn:aws:logs:us-east-1:123456789012:log-group:test-other:*"},
+						{"logGroupName": "test", "arn": "arn:aws:logs:us-east-1:123456789012:log-group:test:*"}
+					]
+				}
+			`))
+		}
+	})
+
+	assert.Equal(t, "test", logger.LogGroupName())
+	assert.Equal(t, streamNames, logger.StreamNames())
+
+	for i := 0; i < 2; i++ {
+		arn, err := logger.LogGroupARN(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "arn:aws:logs:us-east-1:123456789012:log-group:test:*", arn)
+	}
+	assert.Equal(t, 1, describeCalls)
+}
+
+func TestAccountIDVerifiesLogGroup(t *testing.T) {
+	var actions []string
+	config := &Config{
+		LogGroupName: "test",
+		AccountID:    "210987654321",
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		actions = append(actions, action(r))
+		if action(r) == "DescribeLogGroups" {
+			w.Write([]byte(`
+				{
+					"logGroups": [
+						{"logGroupName": "test", "arn": "arn:aws:logs:us-east-1:210987654321:log-group:test:*"}
+					]
+				}
+			`))
+		}
+	})
+	logger.Close()
+
+	assert.Equal(t, []string{"DescribeLogGroups", "CreateLogStream"}, actions)
+}
+
+func TestAccountIDMismatch(t *testing.T) {
+	var calls int
+	logger, err := New(&Config{
+		Client: newClientWithServer(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Write([]byte(`
+				{
+					"logGroups": [
+						{"logGroupName": "test", "arn": "arn:aws:logs:us-east-1:123456789012:log-group:test:*"}
+					]
+				}
+			`))
+		}),
+		LogGroupName: "test",
+		AccountID:    "210987654321",
+	})
+
+	assert.Nil(t, logger)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "belongs to account 123456789012, not 210987654321")
+	}
+	assert.Equal(t, 1, calls)
+}
+
+func TestAccountIDLogGroupNotFound(t *testing.T) {
+	logger, err := New(&Config{
+		Client: newClientWithServer(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"logGroups": []}`))
+		}),
+		LogGroupName: "test",
+		AccountID:    "210987654321",
+	})
+
+	assert.Nil(t, logger)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `Unable to find log group "test"`)
+	}
+}
+
+func TestAssumeLogGroupExists(t *testing.T) {
+	var actions []string
+	config := &Config{
+		LogGroupName:         "test",
+		Retention:            90,
+		AssumeLogGroupExists: true,
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		actions = append(actions, action(r))
+	})
+	logger.Close()
+
+	assert.Equal(t, []string{"CreateLogStream"}, actions)
+}
+
+func TestAssumeLogGroupExistsEnforcesRetention(t *testing.T) {
+	var actions []string
+	var retention PutRetentionPolicy
+	config := &Config{
+		LogGroupName:         "test",
+		Retention:            90,
+		AssumeLogGroupExists: true,
+		EnforceRetention:     true,
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		actions = append(actions, action(r))
+		if action(r) == "PutRetentionPolicy" {
+			parseBody(r, &retention)
+		}
+	})
+	logger.Close()
+
+	assert.Equal(t, []string{"PutRetentionPolicy", "CreateLogStream"}, actions)
+	assert.Equal(t, 90, retention.RetentionInDays)
+}
+
+func TestAssumeLogGroupExistsWithWriteOnlyClient(t *testing.T) {
+	var actions []string
+	var reported []error
+	config := &Config{
+		LogGroupName:         "test",
+		Retention:            90,
+		AssumeLogGroupExists: true,
+		EnforceRetention:     true,
+		ErrorReporter: func(err error) {
+			reported = append(reported, err)
+		},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		actions = append(actions, action(r))
+		switch action(r) {
+		case "CreateLogGroup", "PutRetentionPolicy":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"AccessDeniedException","message":"not authorized"}`))
+		case "PutLogEvents":
+			w.Write([]byte(`{"nextSequenceToken":"1"}`))
+		}
+	})
+	logger.Log(time.Now(), "message")
+	logger.Close()
+
+	assert.Equal(t, []string{"PutRetentionPolicy", "CreateLogStream", "PutLogEvents"}, actions)
+	if assert.Len(t, reported, 1) {
+		assert.Contains(t, reported[0].Error(), "Unable to set log group retention")
+		assert.Contains(t, reported[0].Error(), "AccessDeniedException")
+	}
+	assert.EqualValues(t, 1, logger.Stats().BatchesSent)
+}
+
+func TestCheckLogGroup(t *testing.T) {
+	var actions []string
+	config := &Config{
+		LogGroupName:  "test",
+		Retention:     90,
+		CheckLogGroup: true,
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		actions = append(actions, action(r))
+		if action(r) == "DescribeLogGroups" {
+			w.Write([]byte(`{"logGroups": [{"logGroupName": "test-other"}, {"logGroupName": "test"}]}`))
+		}
+	})
+	logger.Close()
+
+	assert.Equal(t, []string{"DescribeLogGroups", "CreateLogStream"}, actions)
+}
+
+func TestCheckLogGroupCreatesMissingLogGroup(t *testing.T) {
+	var actions []string
+	config := &Config{
+		LogGroupName:  "test",
+		Retention:     90,
+		CheckLogGroup: true,
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		actions = append(actions, action(r))
+		if action(r) == "DescribeLogGroups" {
+			w.Write([]byte(`{"logGroups": [{"logGroupName": "test-other"}]}`))
+		}
+	})
+	logger.Close()
+
+	assert.Equal(t, []string{"DescribeLogGroups", "CreateLogGroup", "PutRetentionPolicy", "CreateLogStream"}, actions)
+}
+
 func TestCreatesRetentionPolicy(t *testing.T) {
 	logGroupCreated := false
 	retentionPolicyCreated := false
@@ -84,344 +508,1799 @@ func TestCreatesRetentionPolicy(t *testing.T) {
 	assert.True(t, retentionPolicyCreated)
 }
 
-func TestHandlesExistingGroup(t *testing.T) {
-	logStreamCreated := false
-	retentionPolicyCreated := false
+func TestHandlesExistingGroup(t *testing.T) {
+	logStreamCreated := false
+	retentionPolicyCreated := false
+	config := &Config{
+		LogGroupName: "test",
+		Retention:    30,
+	}
+
+	newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "CreateLogGroup" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`
+				{
+					"__type": "ResourceAlreadyExistsException",
+					"message": "The specified log group already exists"
+				}
+			`))
+		}
+		if action(r) == "CreateLogStream" {
+			logStreamCreated = true
+		}
+		if action(r) == "PutRetentionPolicy" {
+			retentionPolicyCreated = true
+		}
+	})
+
+	assert.True(t, logStreamCreated)
+	assert.False(t, retentionPolicyCreated)
+}
+
+func TestEnforceRetentionOnExistingGroup(t *testing.T) {
+	var actions []string
+	var retention PutRetentionPolicy
+	config := &Config{
+		LogGroupName:     "test",
+		Retention:        30,
+		EnforceRetention: true,
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		actions = append(actions, action(r))
+		if action(r) == "CreateLogGroup" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type": "ResourceAlreadyExistsException"}`))
+		}
+		if action(r) == "PutRetentionPolicy" {
+			parseBody(r, &retention)
+		}
+	})
+	logger.Close()
+
+	assert.Equal(t, []string{"CreateLogGroup", "PutRetentionPolicy", "CreateLogStream"}, actions)
+	assert.Equal(t, 30, retention.RetentionInDays)
+}
+
+func TestEnforceRetentionWithCheckLogGroup(t *testing.T) {
+	for _, current := range []int{0, 7, 30} {
+		var actions []string
+		config := &Config{
+			LogGroupName:     "test",
+			Retention:        30,
+			EnforceRetention: true,
+			CheckLogGroup:    true,
+		}
+
+		logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+			actions = append(actions, action(r))
+			if action(r) == "DescribeLogGroups" {
+				fmt.Fprintf(w, `{"logGroups": [{"logGroupName": "test", "retentionInDays": %d}]}`, current)
+			}
+		})
+		logger.Close()
+
+		if current == 30 {
+			assert.Equal(t, []string{"DescribeLogGroups", "CreateLogStream"}, actions)
+		} else {
+			assert.Equal(t, []string{"DescribeLogGroups", "PutRetentionPolicy", "CreateLogStream"}, actions, "retention %d", current)
+		}
+	}
+}
+
+func TestDeleteLogGroupThatDoesNotExist(t *testing.T) {
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "DeleteLogGroup" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type": "ResourceNotFoundException"}`))
+		}
+	})
+
+	assert.NoError(t, logger.DeleteLogGroup(context.Background()))
+}
+
+func TestSendsLogsToCloudWatchLogs(t *testing.T) {
+	stg := new(SequenceTokenGenerator)
+	var logStreamName string
+	var req PutLogEvents
+
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "CreateLogStream" {
+			var data CreateLogStream
+			parseBody(r, &data)
+			logStreamName = data.LogStreamName
+		}
+		if action(r) == "PutLogEvents" {
+			parseBody(r, &req)
+			stg.Write(w)
+		}
+	})
+
+	now := time.Unix(time.Now().Unix(), 0)
+	logger.Log(now, "LOG MESSAGE")
+	logger.Close()
+
+	assert.Equal(t, "test", req.LogGroupName)
+	assert.Equal(t, logStreamName, req.LogStreamName)
+	assert.EqualValues(t, now.Unix()*1000, req.LogEvents[0].Timestamp)
+	assert.Equal(t, "LOG MESSAGE", req.LogEvents[0].Message)
+	assert.Nil(t, req.SequenceToken)
+}
+
+func TestLogStreamNameCreatesStream(t *testing.T) {
+	var actions []string
+	var createdStream string
+	var req PutLogEvents
+	config := &Config{
+		LogGroupName:  "test",
+		LogStreamName: "host-1",
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		actions = append(actions, action(r))
+		switch action(r) {
+		case "DescribeLogStreams":
+			w.Write([]byte(`{"logStreams":[{"logStreamName":"host-10"}]}`))
+		case "CreateLogStream":
+			var data CreateLogStream
+			parseBody(r, &data)
+			createdStream = data.LogStreamName
+		case "PutLogEvents":
+			parseBody(r, &req)
+			w.Write([]byte(`{"nextSequenceToken":"1"}`))
+		}
+	})
+
+	logger.Log(time.Now(), "message")
+	logger.Close()
+
+	assert.Equal(t, []string{"CreateLogGroup", "DescribeLogStreams", "CreateLogStream", "PutLogEvents"}, actions)
+	assert.Equal(t, "host-1", createdStream)
+	assert.Equal(t, "host-1", req.LogStreamName)
+	assert.Nil(t, req.SequenceToken)
+}
+
+func TestLogStreamNameResumesExistingStream(t *testing.T) {
+	var actions []string
+	var req PutLogEvents
+	config := &Config{
+		LogGroupName:  "test",
+		LogStreamName: "host-1",
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		actions = append(actions, action(r))
+		switch action(r) {
+		case "DescribeLogStreams":
+			var data struct {
+				NextToken *string `json:"nextToken"`
+			}
+			parseBody(r, &data)
+			if data.NextToken == nil {
+				w.Write([]byte(`{"logStreams":[{"logStreamName":"host-10"}],"nextToken":"page-2"}`))
+			} else {
+				w.Write([]byte(`{"logStreams":[{"logStreamName":"host-1","uploadSequenceToken":"42"}]}`))
+			}
+		case "PutLogEvents":
+			parseBody(r, &req)
+			w.Write([]byte(`{"nextSequenceToken":"43"}`))
+		}
+	})
+
+	logger.Log(time.Now(), "message")
+	logger.Close()
+
+	assert.Equal(t, []string{"CreateLogGroup", "DescribeLogStreams", "DescribeLogStreams", "PutLogEvents"}, actions)
+	assert.Equal(t, "host-1", req.LogStreamName)
+	if assert.NotNil(t, req.SequenceToken) {
+		assert.Equal(t, "42", *req.SequenceToken)
+	}
+}
+
+func TestLogStreamNameCreatedConcurrently(t *testing.T) {
+	var actions []string
+	var describes int
+	var req PutLogEvents
+	config := &Config{
+		LogGroupName:  "test",
+		LogStreamName: "shared",
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		actions = append(actions, action(r))
+		switch action(r) {
+		case "DescribeLogStreams":
+			describes++
+			if describes == 1 {
+				w.Write([]byte(`{"logStreams":[]}`))
+			} else {
+				w.Write([]byte(`{"logStreams":[{"logStreamName":"shared","uploadSequenceToken":"5"}]}`))
+			}
+		case "CreateLogStream":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"ResourceAlreadyExistsException","message":"The specified log stream already exists"}`))
+		case "PutLogEvents":
+			parseBody(r, &req)
+			w.Write([]byte(`{"nextSequenceToken":"6"}`))
+		}
+	})
+
+	logger.Log(time.Now(), "message")
+	logger.Close()
+
+	assert.Equal(t,
+		[]string{
+			"CreateLogGroup", "DescribeLogStreams", "CreateLogStream",
+			"DescribeLogStreams", "PutLogEvents",
+		},
+		actions)
+	assert.Equal(t, "shared", req.LogStreamName)
+	if assert.NotNil(t, req.SequenceToken) {
+		assert.Equal(t, "5", *req.SequenceToken)
+	}
+}
+
+func TestExistingStreamBootstrapsSequenceToken(t *testing.T) {
+	var actions []string
+	var describe struct {
+		LogStreamNamePrefix string `json:"logStreamNamePrefix"`
+	}
+	var req PutLogEvents
+	config := &Config{
+		LogGroupName:   "test",
+		StreamNameFunc: func(int) string { return "fixed" },
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		actions = append(actions, action(r))
+		switch action(r) {
+		case "CreateLogStream":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"ResourceAlreadyExistsException"}`))
+		case "DescribeLogStreams":
+			parseBody(r, &describe)
+			w.Write([]byte(`{"logStreams":[{"logStreamName":"fixed.old"},{"logStreamName":"fixed","uploadSequenceToken":"8"}]}`))
+		case "PutLogEvents":
+			parseBody(r, &req)
+			w.Write([]byte(`{"nextSequenceToken":"9"}`))
+		}
+	})
+
+	logger.Log(time.Now(), "message")
+	logger.Close()
+
+	assert.Equal(t, []string{"CreateLogGroup", "CreateLogStream", "DescribeLogStreams", "PutLogEvents"}, actions)
+	assert.Equal(t, "fixed", describe.LogStreamNamePrefix)
+	if assert.NotNil(t, req.SequenceToken) {
+		assert.Equal(t, "8", *req.SequenceToken)
+	}
+}
+
+func TestReuseRecentStream(t *testing.T) {
+	var actions []string
+	var describe struct {
+		OrderBy    string `json:"orderBy"`
+		Descending bool   `json:"descending"`
+		Limit      int    `json:"limit"`
+	}
+	var req PutLogEvents
+	config := &Config{
+		LogGroupName:      "test",
+		ReuseRecentStream: true,
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		actions = append(actions, action(r))
+		switch action(r) {
+		case "DescribeLogStreams":
+			parseBody(r, &describe)
+			w.Write([]byte(`{"logStreams":[{"logStreamName":"previous.0","uploadSequenceToken":"7"}]}`))
+		case "PutLogEvents":
+			parseBody(r, &req)
+			w.Write([]byte(`{"nextSequenceToken":"8"}`))
+		}
+	})
+
+	logger.Log(time.Now(), "message")
+	logger.Close()
+
+	assert.Equal(t, []string{"CreateLogGroup", "DescribeLogStreams", "PutLogEvents"}, actions)
+	assert.Equal(t, "LastEventTime", describe.OrderBy)
+	assert.True(t, describe.Descending)
+	assert.Equal(t, 1, describe.Limit)
+	assert.Equal(t, []string{"previous.0"}, logger.StreamNames())
+	assert.Equal(t, "previous.0", req.LogStreamName)
+	if assert.NotNil(t, req.SequenceToken) {
+		assert.Equal(t, "7", *req.SequenceToken)
+	}
+}
+
+func TestReuseRecentStreamWithoutStreams(t *testing.T) {
+	var actions []string
+	var req PutLogEvents
+	config := &Config{
+		LogGroupName:      "test",
+		ReuseRecentStream: true,
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		actions = append(actions, action(r))
+		switch action(r) {
+		case "DescribeLogStreams":
+			w.Write([]byte(`{"logStreams":[]}`))
+		case "PutLogEvents":
+			parseBody(r, &req)
+			w.Write([]byte(`{"nextSequenceToken":"1"}`))
+		}
+	})
+
+	logger.Log(time.Now(), "message")
+	logger.Close()
+
+	assert.Equal(t, []string{"CreateLogGroup", "DescribeLogStreams", "CreateLogStream", "PutLogEvents"}, actions)
+	assert.Equal(t, logger.StreamNames()[0], req.LogStreamName)
+	assert.Nil(t, req.SequenceToken)
+}
+
+func TestSequenceToken(t *testing.T) {
+	stg := new(SequenceTokenGenerator)
+	logChecker := NewLogChecker(1024)
+	receivedSequenceTokens := []*string{}
+
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			var data PutLogEvents
+			parseBody(r, &data)
+			receivedSequenceTokens = append(receivedSequenceTokens, data.SequenceToken)
+			stg.Write(w)
+		}
+	})
+
+	logChecker.Generate(logger, 3000)
+	logger.Close()
+
+	assert.Len(t, receivedSequenceTokens, 3)
+	assert.Nil(t, receivedSequenceTokens[0])
+	assert.Equal(t, "1", *receivedSequenceTokens[1])
+	assert.Equal(t, "2", *receivedSequenceTokens[2])
+}
+
+func TestDisableSequenceToken(t *testing.T) {
+	stg := new(SequenceTokenGenerator)
+	logChecker := NewLogChecker(1024)
+	var bodies []string
+	config := &Config{
+		LogGroupName:         "test",
+		DisableSequenceToken: true,
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			b, _ := ioutil.ReadAll(r.Body)
+			bodies = append(bodies, string(b))
+			stg.Write(w)
+		}
+	})
+
+	logChecker.Generate(logger, 3000)
+	logger.Close()
+
+	assert.Len(t, bodies, 3)
+	for _, body := range bodies {
+		assert.NotContains(t, body, "sequenceToken")
+	}
+}
+
+func TestEntity(t *testing.T) {
+	var bodies []string
+	config := &Config{
+		LogGroupName: "test",
+		Entity: &types.Entity{
+			KeyAttributes: map[string]string{"Type": "Service", "Name": "api"},
+			Attributes:    map[string]string{"PlatformType": "AWS::EC2"},
+		},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			b, _ := ioutil.ReadAll(r.Body)
+			bodies = append(bodies, string(b))
+		}
+	})
+	logger.Log(time.Now(), "with entity")
+	logger.Close()
+
+	config.Entity = nil
+	logger = newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			b, _ := ioutil.ReadAll(r.Body)
+			bodies = append(bodies, string(b))
+		}
+	})
+	logger.Log(time.Now(), "without entity")
+	logger.Close()
+
+	if assert.Len(t, bodies, 2) {
+		var data struct {
+			Entity struct {
+				KeyAttributes map[string]string `json:"keyAttributes"`
+				Attributes    map[string]string `json:"attributes"`
+			} `json:"entity"`
+		}
+		assert.NoError(t, json.Unmarshal([]byte(bodies[0]), &data))
+		assert.Equal(t, map[string]string{"Type": "Service", "Name": "api"}, data.Entity.KeyAttributes)
+		assert.Equal(t, map[string]string{"PlatformType": "AWS::EC2"}, data.Entity.Attributes)
+		assert.NotContains(t, bodies[1], `"entity"`)
+	}
+}
+
+func TestDataAlreadyAcceptedException(t *testing.T) {
+	var (
+		calls                 int
+		receivedSequenceToken string
+		logChecker            = NewLogChecker(1024)
+	)
+
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			calls++
+
+			var data PutLogEvents
+			parseBody(r, &data)
+
+			if calls == 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`
+					{
+						"__type": "DataAlreadyAcceptedException",
+						"expectedSequenceToken": "2"
+					}
+				`))
+			} else {
+				receivedSequenceToken = *data.SequenceToken
+				w.Write([]byte(`{"nextSequenceToken":"3"}`))
+			}
+		}
+	})
+
+	logChecker.Generate(logger, 20)
+	logger.Flush()
+	logger.Log(time.Now(), "message")
+	logger.Close()
+
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, "2", receivedSequenceToken)
+	stats := logger.Stats()
+	assert.EqualValues(t, 2, stats.BatchesSent)
+	assert.EqualValues(t, 0, stats.BatchesRetried)
+	assert.EqualValues(t, 1, stats.DuplicateBatches)
+}
+
+func TestInvalidSequenceTokenException(t *testing.T) {
+	var (
+		calls                 int
+		receivedSequenceToken string
+	)
+
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			calls++
+			if calls == 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`
+					{
+						"__type": "InvalidSequenceTokenException",
+						"expectedSequenceToken": "2"
+					}
+				`))
+			} else {
+				var data PutLogEvents
+				parseBody(r, &data)
+				receivedSequenceToken = *data.SequenceToken
+				w.Write([]byte(`{"nextSequenceToken":"3"}`))
+			}
+		}
+	})
+
+	logger.Log(time.Now(), "message")
+	logger.Close()
+
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, "2", receivedSequenceToken)
+}
+
+func TestDebugLogger(t *testing.T) {
+	var messages []string
+	var calls int
+	config := &Config{
+		LogGroupName: "test",
+		DebugLogger: func(format string, v ...interface{}) {
+			messages = append(messages, fmt.Sprintf(format, v...))
+		},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			calls++
+			if calls == 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`
+					{
+						"__type": "InvalidSequenceTokenException",
+						"expectedSequenceToken": "2"
+					}
+				`))
+			} else {
+				w.Write([]byte(`{"nextSequenceToken":"3"}`))
+			}
+		}
+	})
+
+	logger.Log(time.Now(), "message")
+	logger.Close()
+
+	assert.Len(t, messages, 1)
+	assert.Contains(t, messages[0], "invalid sequence token")
+}
+
+func TestSequenceTokenErrorsAreCounted(t *testing.T) {
+	withoutJitter(t, time.Millisecond)
+
+	var messages []string
+	var calls int
+	config := &Config{
+		LogGroupName: "test",
+		MaxRetries:   10,
+		DebugLogger: func(format string, v ...interface{}) {
+			messages = append(messages, fmt.Sprintf(format, v...))
+		},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			calls++
+			switch {
+			case calls <= 4:
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"__type": "InvalidSequenceTokenException", "expectedSequenceToken": "2"}`))
+			case calls <= 5:
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"__type": "DataAlreadyAcceptedException", "expectedSequenceToken": "3"}`))
+			default:
+				w.Write([]byte(`{"nextSequenceToken":"4"}`))
+			}
+		}
+	})
+
+	logger.Log(time.Now(), "message")
+	logger.Flush()
+	logger.Log(time.Now(), "message")
+	logger.Close()
+
+	stats := logger.Stats()
+	assert.EqualValues(t, 4, stats.InvalidTokenRecoveries)
+	assert.EqualValues(t, 1, stats.DuplicateBatches)
+	assert.Equal(t, 6, calls)
+	assert.Len(t, messages, 1)
+}
+
+func TestRejectedLogEvents(t *testing.T) {
+	var reported []error
+	config := &Config{
+		LogGroupName: "test",
+		ErrorReporter: func(err error) {
+			reported = append(reported, err)
+		},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			w.Write([]byte(`
+				{
+					"nextSequenceToken": "1",
+					"rejectedLogEventsInfo": {
+						"tooOldLogEventEndIndex": 2,
+						"tooNewLogEventStartIndex": 7
+					}
+				}
+			`))
+		}
+	})
+
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		logger.Log(now.Add(time.Duration(i)*time.Millisecond), "message")
+	}
+	logger.Close()
+
+	assert.Equal(t, []error{
+		&RejectedLogEventsError{Reason: RejectedTooNew, Count: 3},
+		&RejectedLogEventsError{Reason: RejectedTooOld, Count: 2},
+	}, reported)
+	assert.EqualValues(t, 5, logger.Stats().EventsDropped)
+	assert.Equal(t, "cwlogger: 3 log events rejected as too new", reported[0].Error())
+}
+
+func TestLogSyncRejectedLogEvents(t *testing.T) {
+	config := &Config{
+		LogGroupName:  "test",
+		FlushInterval: 100 * time.Millisecond,
+	}
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			w.Write([]byte(`
+				{
+					"nextSequenceToken": "1",
+					"rejectedLogEventsInfo": {
+						"tooOldLogEventEndIndex": 1,
+						"tooNewLogEventStartIndex": 2
+					}
+				}
+			`))
+		}
+	})
+	defer logger.Close()
+
+	// The log events are written in timestamp order, whatever the order they
+	// were logged in.
+	now := time.Now()
+	offsets := []time.Duration{time.Second, -time.Second, 0}
+	errs := make([]error, len(offsets))
+	var wg sync.WaitGroup
+	for i, offset := range offsets {
+		wg.Add(1)
+		go func(i int, offset time.Duration) {
+			defer wg.Done()
+			errs[i] = logger.LogSync(context.Background(), now.Add(offset), "message "+strconv.Itoa(i))
+		}(i, offset)
+	}
+	wg.Wait()
+
+	assert.Equal(t, []error{
+		&RejectedLogEventsError{Reason: RejectedTooNew, Count: 1},
+		&RejectedLogEventsError{Reason: RejectedTooOld, Count: 1},
+		nil,
+	}, errs)
+}
+
+func TestThrottlingException(t *testing.T) {
+	stg := new(SequenceTokenGenerator)
+	logChecker := NewLogChecker(1024)
+	actions := []string{}
+	var calls int
+
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		actions = append(actions, action(r))
+		if action(r) == "PutLogEvents" {
+			calls++
+			if calls == 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"__type":"ThrottlingException"}`))
+			} else {
+				var data PutLogEvents
+				parseBody(r, &data)
+				logChecker.Record(data.LogEvents)
+				stg.Write(w)
+			}
+		}
+	})
+
+	logChecker.Generate(logger, 1000)
+	logger.Close()
+
+	assert.Equal(t,
+		[]string{
+			"CreateLogGroup", "CreateLogStream", "PutLogEvents", "CreateLogStream",
+			"PutLogEvents",
+		},
+		actions)
+
+	logChecker.Assert(t)
+}
+
+func TestMaxStreams(t *testing.T) {
+	withoutJitter(t, time.Millisecond)
+
+	var mu sync.Mutex
+	var created, calls int
+	var delivered []string
+	config := &Config{
+		LogGroupName: "test",
+		MaxStreams:   2,
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch action(r) {
+		case "CreateLogStream":
+			created++
+		case "PutLogEvents":
+			calls++
+			if calls <= 4 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"__type":"ThrottlingException"}`))
+				return
+			}
+			var data PutLogEvents
+			parseBody(r, &data)
+			for _, event := range data.LogEvents {
+				delivered = append(delivered, event.Message)
+			}
+			w.Write([]byte(`{"nextSequenceToken":"1"}`))
+		}
+	})
+
+	logger.Log(time.Now(), "message")
+	logger.Flush()
+
+	assert.EqualValues(t, 2, logger.Stats().CurrentStreams)
+	assert.EqualError(t, logger.AddStream(), "cwlogger: unable to add log streams beyond the maximum of 2")
+	logger.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 2, created)
+	assert.Equal(t, 5, calls)
+	assert.Equal(t, []string{"message"}, delivered)
+}
+
+func TestStreamsLimitedToMaxStreams(t *testing.T) {
+	config := &Config{
+		LogGroupName: "test",
+		Streams:      5,
+		MaxStreams:   3,
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {})
+	defer logger.Close()
+
+	assert.EqualValues(t, 3, logger.Stats().CurrentStreams)
+}
+
+func TestOrderedSingleStream(t *testing.T) {
+	withoutJitter(t, time.Millisecond)
+
+	actions := []string{}
+	streams := map[string]int{}
+	var calls int
+	config := &Config{
+		LogGroupName:        "test",
+		Streams:             3,
+		OrderedSingleStream: true,
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		actions = append(actions, action(r))
+		if action(r) == "PutLogEvents" {
+			calls++
+			if calls == 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"__type":"ThrottlingException"}`))
+				return
+			}
+			var data PutLogEvents
+			parseBody(r, &data)
+			streams[data.LogStreamName]++
+		}
+	})
+
+	for i := 0; i < 3; i++ {
+		logger.Log(time.Now(), "message")
+		logger.Flush()
+	}
+	logger.Close()
+
+	assert.Equal(t,
+		[]string{
+			"CreateLogGroup", "CreateLogStream", "PutLogEvents", "PutLogEvents",
+			"PutLogEvents", "PutLogEvents",
+		},
+		actions)
+	assert.Equal(t, map[string]int{logger.StreamNames()[0]: 3}, streams)
+}
+
+func TestResourceNotFoundRecreatesGroupAndStream(t *testing.T) {
+	actions := []string{}
+	var streams []string
+	var delivered []string
+	var reported []error
+	var calls int
+	config := &Config{
+		LogGroupName: "test",
+		ErrorReporter: func(err error) {
+			reported = append(reported, err)
+		},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		actions = append(actions, action(r))
+		switch action(r) {
+		case "CreateLogStream":
+			var data CreateLogStream
+			parseBody(r, &data)
+			streams = append(streams, data.LogStreamName)
+		case "PutLogEvents":
+			calls++
+			if calls == 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"The specified log group does not exist."}`))
+				return
+			}
+			var data PutLogEvents
+			parseBody(r, &data)
+			for _, event := range data.LogEvents {
+				delivered = append(delivered, event.Message)
+			}
+			w.Write([]byte(`{"nextSequenceToken":"1"}`))
+		}
+	})
+
+	logger.Log(time.Now(), "message")
+	logger.Close()
+
+	assert.Equal(t,
+		[]string{
+			"CreateLogGroup", "CreateLogStream", "PutLogEvents", "CreateLogGroup",
+			"CreateLogStream", "PutLogEvents",
+		},
+		actions)
+	if assert.Len(t, streams, 2) {
+		assert.Equal(t, streams[0], streams[1])
+	}
+	assert.Equal(t, []string{"message"}, delivered)
+	assert.Empty(t, reported)
+}
+
+func TestRecreatedStreamForgetsSequenceToken(t *testing.T) {
+	var tokens []*string
+	var calls int
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			var data PutLogEvents
+			parseBody(r, &data)
+			tokens = append(tokens, data.SequenceToken)
+			calls++
+			if calls == 2 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"The specified log stream does not exist."}`))
+				return
+			}
+			w.Write([]byte(`{"nextSequenceToken":"1"}`))
+		}
+	})
+
+	logger.Log(time.Now(), "first")
+	logger.Flush()
+	logger.Log(time.Now(), "second")
+	logger.Close()
+
+	assert.Equal(t, []*string{nil, aws.String("1"), nil}, tokens)
+}
+
+func TestRecreateWhileWriting(t *testing.T) {
+	var mu sync.Mutex
+	var delivered int
+	var calls int
+	config := &Config{
+		LogGroupName:  "test",
+		FlushInterval: time.Millisecond,
+	}
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			var data PutLogEvents
+			parseBody(r, &data)
+			mu.Lock()
+			defer mu.Unlock()
+			calls++
+			if calls%3 == 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"The specified log stream does not exist."}`))
+				return
+			}
+			delivered += len(data.LogEvents)
+			w.Write([]byte(`{"nextSequenceToken":"` + strconv.Itoa(calls) + `"}`))
+		}
+	})
+
+	for i := 0; i < 50; i++ {
+		logger.Log(time.Now(), "message")
+		time.Sleep(time.Millisecond)
+	}
+	logger.Close()
+
+	assert.Equal(t, 50, delivered)
+}
+
+func TestConnectionFailure(t *testing.T) {
+	stg := new(SequenceTokenGenerator)
+	logChecker := NewLogChecker(1024)
+	var calls int
+
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			calls++
+			if calls == 1 {
+				hj, _ := w.(http.Hijacker)
+				conn, _, _ := hj.Hijack()
+				conn.Close()
+			} else {
+				var data PutLogEvents
+				parseBody(r, &data)
+				logChecker.Record(data.LogEvents)
+				stg.Write(w)
+			}
+		}
+	})
+
+	logChecker.Generate(logger, 1000)
+	logger.Close()
+
+	logChecker.Assert(t)
+}
+
+func TestLogStreamCreationFailureAfterThrottlingException(t *testing.T) {
+	stg := new(SequenceTokenGenerator)
+	logChecker := NewLogChecker(1024)
+	actions := []string{}
+	var calls int
+
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		actions = append(actions, action(r))
+		calls++
+		if action(r) == "CreateLogStream" && calls == 4 {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"__type":"ServiceUnavailableException"}`))
+		}
+		if action(r) == "PutLogEvents" {
+			if calls == 3 || calls == 5 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"__type":"ThrottlingException"}`))
+			} else {
+				var data PutLogEvents
+				parseBody(r, &data)
+				logChecker.Record(data.LogEvents)
+				stg.Write(w)
+			}
+		}
+	})
+
+	logChecker.Generate(logger, 1000)
+	logger.Close()
+
+	assert.Equal(t,
+		[]string{
+			"CreateLogGroup", "CreateLogStream", "PutLogEvents", "CreateLogStream",
+			"PutLogEvents", "CreateLogStream", "PutLogEvents"},
+		actions)
+
+	logChecker.Assert(t)
+}
+
+func TestInvalidJSONResponses(t *testing.T) {
+	stg := new(SequenceTokenGenerator)
+	logChecker := NewLogChecker(1024)
+	var calls int
+
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			calls++
+			if calls == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("invalid"))
+			} else if calls == 2 {
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte("invalid"))
+			} else {
+				var data PutLogEvents
+				parseBody(r, &data)
+				logChecker.Record(data.LogEvents)
+				stg.Write(w)
+			}
+		}
+	})
+
+	logChecker.Generate(logger, 1000)
+	logger.Close()
+
+	logChecker.Assert(t)
+}
+
+func TestBatchByteSizeLimit(t *testing.T) {
+	stg := new(SequenceTokenGenerator)
+	logChecker := NewLogChecker(1024)
+
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			var data PutLogEvents
+			parseBody(r, &data)
+			logChecker.Record(data.LogEvents)
+			assert.Len(t, data.LogEvents, 1024)
+			stg.Write(w)
+		}
+	})
+
+	logChecker.Generate(logger, 3072)
+	logger.Close()
+
+	logChecker.Assert(t)
+}
+
+func TestBatchLengthLimit(t *testing.T) {
+	stg := new(SequenceTokenGenerator)
+	logChecker := NewLogChecker(55)
+
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			var data PutLogEvents
+			parseBody(r, &data)
+			logChecker.Record(data.LogEvents)
+			assert.Len(t, data.LogEvents, 10000)
+			stg.Write(w)
+		}
+	})
+
+	logChecker.Generate(logger, 30000)
+	logger.Close()
+
+	logChecker.Assert(t)
+}
+
+func TestMessageAtSizeLimit(t *testing.T) {
+	var received []int
+
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			var data PutLogEvents
+			parseBody(r, &data)
+			for _, event := range data.LogEvents {
+				received = append(received, len(event.Message))
+			}
+			w.Write([]byte(`{"nextSequenceToken":"1"}`))
+		}
+	})
+
+	err := logger.LogE(time.Now(), strings.Repeat(".", maxMessageSize))
+	logger.Close()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int{maxMessageSize}, received)
+}
+
+func TestMessageOverSizeLimit(t *testing.T) {
+	var calls int
+	var reported []error
+	config := &Config{
+		LogGroupName: "test",
+		ErrorReporter: func(err error) {
+			reported = append(reported, err)
+		},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			calls++
+		}
+	})
+
+	message := strings.Repeat(".", maxMessageSize+1)
+	err := logger.LogE(time.Now(), message)
+	logger.Log(time.Now(), message)
+	logger.Close()
+
+	assert.Equal(t, ErrMessageTooLarge, err)
+	assert.Equal(t, []error{ErrMessageTooLarge}, reported)
+	assert.Equal(t, 0, calls)
+}
+
+func TestEmptyMessages(t *testing.T) {
+	var reported []error
+	var req PutLogEvents
+	config := &Config{
+		LogGroupName: "test",
+		ErrorReporter: func(err error) {
+			reported = append(reported, err)
+		},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			parseBody(r, &req)
+		}
+	})
+
+	logger.Log(time.Now(), "first")
+	logger.Log(time.Now(), "")
+	err := logger.LogE(time.Now(), " \t\n")
+	logger.Log(time.Now(), "second")
+	logger.Close()
+
+	assert.Equal(t, ErrEmptyMessage, err)
+	assert.Equal(t, []error{ErrEmptyMessage}, reported)
+	if assert.Len(t, req.LogEvents, 2) {
+		assert.Equal(t, "first", req.LogEvents[0].Message)
+		assert.Equal(t, "second", req.LogEvents[1].Message)
+	}
+}
+
+func TestAllowEmptyMessages(t *testing.T) {
+	var req PutLogEvents
+	config := &Config{
+		LogGroupName:       "test",
+		AllowEmptyMessages: true,
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			parseBody(r, &req)
+		}
+	})
+
+	err := logger.LogE(time.Now(), " ")
+	logger.Close()
+
+	assert.NoError(t, err)
+	assert.Len(t, req.LogEvents, 1)
+}
+
+func TestLogStruct(t *testing.T) {
+	var req PutLogEvents
+
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			parseBody(r, &req)
+		}
+	})
+
+	record := struct {
+		Level   string `json:"level"`
+		Message string `json:"msg"`
+		Count   int    `json:"count"`
+	}{"info", "hello", 3}
+	err := logger.LogStruct(time.Now(), record)
+	logger.Close()
+
+	assert.NoError(t, err)
+	if assert.Len(t, req.LogEvents, 1) {
+		assert.JSONEq(t, `{"level":"info","msg":"hello","count":3}`, req.LogEvents[0].Message)
+	}
+}
+
+func TestLogStructErrors(t *testing.T) {
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {})
+	defer logger.Close()
+
+	err := logger.LogStruct(time.Now(), make(chan int))
+	var unsupported *json.UnsupportedTypeError
+	assert.True(t, errors.As(err, &unsupported))
+
+	err = logger.LogStruct(time.Now(), strings.Repeat(".", maxMessageSize))
+	assert.Equal(t, ErrMessageTooLarge, err)
+}
+
+func TestLogWithFields(t *testing.T) {
+	var req PutLogEvents
+	config := &Config{
+		LogGroupName: "test",
+		DefaultFields: map[string]interface{}{
+			"service": "api",
+			"region":  "us-east-1",
+		},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			parseBody(r, &req)
+		}
+	})
+
+	now := time.Now().UTC().Truncate(time.Second)
+	err := logger.LogWithFields(now, "hello", map[string]interface{}{
+		"region":  "eu-west-1",
+		"status":  200,
+		"message": "ignored",
+	})
+	logger.Close()
+
+	assert.NoError(t, err)
+	if assert.Len(t, req.LogEvents, 1) {
+		expected := fmt.Sprintf(
+			`{"message":"hello","timestamp":%q,"service":"api","region":"eu-west-1","status":200}`,
+			now.Format(time.RFC3339Nano),
+		)
+		assert.JSONEq(t, expected, req.LogEvents[0].Message)
+	}
+}
+
+func TestIncludeSourceMetadata(t *testing.T) {
+	var req PutLogEvents
+	config := &Config{
+		LogGroupName:          "test",
+		LogStreamName:         "stream",
+		DefaultFields:         map[string]interface{}{"logGroup": "ignored"},
+		IncludeSourceMetadata: true,
+		ClientOptions: []func(*cloudwatchlogs.Options){
+			func(o *cloudwatchlogs.Options) { o.Region = "ap-southeast-2" },
+		},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			parseBody(r, &req)
+		}
+	})
+
+	now := time.Now().UTC().Truncate(time.Second)
+	err := logger.LogWithFields(now, "hello", map[string]interface{}{"region": "ignored"})
+	logger.Close()
+
+	assert.NoError(t, err)
+	if assert.Len(t, req.LogEvents, 1) {
+		expected := fmt.Sprintf(
+			`{"message":"hello","timestamp":%q,"logGroup":"test","logStream":"stream","region":"ap-southeast-2"}`,
+			now.Format(time.RFC3339Nano),
+		)
+		assert.JSONEq(t, expected, req.LogEvents[0].Message)
+	}
+}
+
+type traceIDKey struct{}
+
+func TestLogCtxFields(t *testing.T) {
+	var req PutLogEvents
+	config := &Config{
+		LogGroupName:  "test",
+		DefaultFields: map[string]interface{}{"service": "api"},
+		ContextExtractor: func(ctx context.Context) map[string]interface{} {
+			if traceID, ok := ctx.Value(traceIDKey{}).(string); ok {
+				return map[string]interface{}{"trace_id": traceID}
+			}
+			return nil
+		},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			parseBody(r, &req)
+		}
+	})
+
+	now := time.Now().UTC().Truncate(time.Second)
+	ctx := context.WithValue(context.Background(), traceIDKey{}, "1-abc-def")
+	err := logger.LogCtxFields(ctx, now, "hello")
+	logger.Close()
+
+	assert.NoError(t, err)
+	if assert.Len(t, req.LogEvents, 1) {
+		expected := fmt.Sprintf(
+			`{"message":"hello","timestamp":%q,"service":"api","trace_id":"1-abc-def"}`,
+			now.Format(time.RFC3339Nano),
+		)
+		assert.JSONEq(t, expected, req.LogEvents[0].Message)
+	}
+}
+
+func TestCoalesceDuplicates(t *testing.T) {
+	var events []*InputLogEvent
+	config := &Config{
+		LogGroupName:       "test",
+		CoalesceDuplicates: true,
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			var data PutLogEvents
+			parseBody(r, &data)
+			events = append(events, data.LogEvents...)
+		}
+	})
+
+	start := time.Unix(time.Now().Unix(), 0)
+	for i := 0; i < 100; i++ {
+		logger.Log(start.Add(time.Duration(i)*time.Millisecond), "connection refused")
+	}
+	logger.Close()
+
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "connection refused (repeated 100 times)", events[0].Message)
+		assert.EqualValues(t, start.Unix()*1000, events[0].Timestamp)
+	}
+	stats := logger.Stats()
+	assert.EqualValues(t, 100, stats.EventsAccepted)
+	assert.EqualValues(t, 1, stats.BatchesSent)
+}
+
+func TestMessageTransform(t *testing.T) {
+	var messages []string
+	password := regexp.MustCompile(`password=\S+`)
+	config := &Config{
+		LogGroupName: "test",
+		MessageTransform: func(s string) string {
+			return password.ReplaceAllString(s, "password=REDACTED")
+		},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			var data PutLogEvents
+			parseBody(r, &data)
+			for _, event := range data.LogEvents {
+				messages = append(messages, event.Message)
+			}
+		}
+	})
+
+	logger.Log(time.Now(), "login user=alice password=hunter2 ok")
+	logger.Close()
+
+	assert.Equal(t, []string{"login user=alice password=REDACTED ok"}, messages)
+}
+
+func TestMessageTransformBeforeSizeCheck(t *testing.T) {
 	config := &Config{
 		LogGroupName: "test",
-		Retention:    30,
+		MessageTransform: func(s string) string {
+			return s[:10]
+		},
 	}
 
-	newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
-		if action(r) == "CreateLogGroup" {
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte(`
-				{
-					"__type": "ResourceAlreadyExistsException",
-					"message": "The specified log group already exists"
-				}
-			`))
-		}
-		if action(r) == "CreateLogStream" {
-			logStreamCreated = true
-		}
-		if action(r) == "PutRetentionPolicy" {
-			retentionPolicyCreated = true
-		}
-	})
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {})
+	defer logger.Close()
 
-	assert.True(t, logStreamCreated)
-	assert.False(t, retentionPolicyCreated)
+	assert.NoError(t, logger.LogE(time.Now(), strings.Repeat(".", maxMessageSize+1)))
 }
 
-func TestSendsLogsToCloudWatchLogs(t *testing.T) {
-	stg := new(SequenceTokenGenerator)
-	var logStreamName string
-	var req PutLogEvents
+func TestBatchIsSortedByTimestamp(t *testing.T) {
+	var timestamps []int64
 
 	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
-		if action(r) == "CreateLogStream" {
-			var data CreateLogStream
-			parseBody(r, &data)
-			logStreamName = data.LogStreamName
-		}
 		if action(r) == "PutLogEvents" {
-			parseBody(r, &req)
-			stg.Write(w)
+			var data PutLogEvents
+			parseBody(r, &data)
+			for _, event := range data.LogEvents {
+				timestamps = append(timestamps, event.Timestamp)
+			}
+			w.Write([]byte(`{"nextSequenceToken":"1"}`))
 		}
 	})
 
-	logger.Log(time.Unix(1500000000, 0), "LOG MESSAGE")
+	start := time.Now()
+	for _, offset := range []int{7, 2, 9, 0, 4, 1, 8, 3, 6, 5} {
+		logger.Log(start.Add(time.Duration(offset)*time.Second), "message")
+	}
 	logger.Close()
 
-	assert.Equal(t, "test", req.LogGroupName)
-	assert.Equal(t, logStreamName, req.LogStreamName)
-	assert.EqualValues(t, 1500000000000, req.LogEvents[0].Timestamp)
-	assert.Equal(t, "LOG MESSAGE", req.LogEvents[0].Message)
-	assert.Nil(t, req.SequenceToken)
+	assert.Len(t, timestamps, 10)
+	assert.True(t, sort.SliceIsSorted(timestamps, func(i, j int) bool {
+		return timestamps[i] < timestamps[j]
+	}))
 }
 
-func TestSequenceToken(t *testing.T) {
+func TestBatchSendsDataAfterTimeout(t *testing.T) {
 	stg := new(SequenceTokenGenerator)
 	logChecker := NewLogChecker(1024)
-	receivedSequenceTokens := []*string{}
+	var wg sync.WaitGroup
 
 	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
 		if action(r) == "PutLogEvents" {
 			var data PutLogEvents
 			parseBody(r, &data)
-			receivedSequenceTokens = append(receivedSequenceTokens, data.SequenceToken)
+			logChecker.Record(data.LogEvents)
 			stg.Write(w)
+			wg.Done()
 		}
 	})
 
-	logChecker.Generate(logger, 3000)
-	logger.Close()
+	wg.Add(2)
+	logChecker.Generate(logger, 2000)
+	wg.Wait()
 
-	assert.Len(t, receivedSequenceTokens, 3)
-	assert.Nil(t, receivedSequenceTokens[0])
-	assert.Equal(t, "1", *receivedSequenceTokens[1])
-	assert.Equal(t, "2", *receivedSequenceTokens[2])
+	logChecker.Assert(t)
 }
 
-func TestDataAlreadyAcceptedException(t *testing.T) {
-	var (
-		calls                 int
-		receivedSequenceToken string
-		logChecker            = NewLogChecker(1024)
-	)
+func TestCloseContextDeadline(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
 
 	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
 		if action(r) == "PutLogEvents" {
-			calls++
+			<-release
+			w.Write([]byte(`{"nextSequenceToken":"1"}`))
+		}
+	})
 
-			var data PutLogEvents
-			parseBody(r, &data)
+	logger.Log(time.Now(), "message")
 
-			if calls == 1 {
-				w.WriteHeader(http.StatusBadRequest)
-				w.Write([]byte(`
-					{
-						"__type": "DataAlreadyAcceptedException",
-						"expectedSequenceToken": "2"
-					}
-				`))
-			} else {
-				receivedSequenceToken = *data.SequenceToken
-				w.Write([]byte(`{"nextSequenceToken":"3"}`))
-			}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := logger.CloseContext(ctx)
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < time.Second, "CloseContext did not return promptly")
+}
+
+func TestFlushInterval(t *testing.T) {
+	sent := make(chan time.Time, 1)
+	config := &Config{
+		LogGroupName:  "test",
+		FlushInterval: 50 * time.Millisecond,
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			sent <- time.Now()
+			w.Write([]byte(`{"nextSequenceToken":"1"}`))
 		}
 	})
 
-	logChecker.Generate(logger, 20)
-	logger.Close()
+	start := time.Now()
+	logger.Log(start, "message")
 
-	assert.Equal(t, 2, calls)
-	assert.Equal(t, "2", receivedSequenceToken)
+	select {
+	case at := <-sent:
+		assert.True(t, at.Sub(start) < 500*time.Millisecond, "flushed after %s", at.Sub(start))
+	case <-time.After(time.Second):
+		assert.Fail(t, "batch was not flushed within the flush interval")
+	}
 }
 
-func TestInvalidSequenceTokenException(t *testing.T) {
-	var (
-		calls                 int
-		receivedSequenceToken string
-	)
+func TestFlush(t *testing.T) {
+	var mu sync.Mutex
+	var messages []string
 
 	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
 		if action(r) == "PutLogEvents" {
-			calls++
-			if calls == 1 {
-				w.WriteHeader(http.StatusBadRequest)
-				w.Write([]byte(`
-					{
-						"__type": "InvalidSequenceTokenException",
-						"expectedSequenceToken": "2"
-					}
-				`))
-			} else {
-				var data PutLogEvents
-				parseBody(r, &data)
-				receivedSequenceToken = *data.SequenceToken
-				w.Write([]byte(`{"nextSequenceToken":"3"}`))
+			var data PutLogEvents
+			parseBody(r, &data)
+			mu.Lock()
+			for _, event := range data.LogEvents {
+				messages = append(messages, event.Message)
 			}
+			mu.Unlock()
+			w.Write([]byte(`{"nextSequenceToken":"` + strconv.Itoa(len(messages)) + `"}`))
 		}
 	})
 
-	logger.Log(time.Now(), "message")
+	start := time.Now()
+	logger.Log(time.Now(), "first")
+	logger.Log(time.Now(), "second")
+	logger.Flush()
+
+	mu.Lock()
+	assert.Equal(t, []string{"first", "second"}, messages)
+	mu.Unlock()
+
+	logger.Log(time.Now(), "third")
+	assert.NoError(t, logger.FlushContext(context.Background()))
+
+	mu.Lock()
+	assert.Equal(t, []string{"first", "second", "third"}, messages)
+	mu.Unlock()
+	assert.True(t, time.Since(start) < time.Second, "Flush waited for the flush interval")
+
 	logger.Close()
+}
 
-	assert.Equal(t, 2, calls)
-	assert.Equal(t, "2", receivedSequenceToken)
+func TestLogBatch(t *testing.T) {
+	client := new(mockClient)
+	logger, err := New(&Config{
+		Client:       client,
+		LogGroupName: "test",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var events []LogEvent
+	var expected []string
+	for i := 0; i < 1000; i++ {
+		message := fmt.Sprintf("message %d", i)
+		events = append(events, LogEvent{Time: time.Now(), Message: message})
+		expected = append(expected, message)
+	}
+	logger.LogBatch(events)
+	logger.Close()
+
+	assert.Equal(t, map[string][]string{
+		logger.StreamNames()[0]: expected,
+	}, client.messages)
+	assert.Equal(t, int64(1000), logger.Stats().EventsAccepted)
 }
 
-func TestThrottlingException(t *testing.T) {
-	stg := new(SequenceTokenGenerator)
-	logChecker := NewLogChecker(1024)
-	actions := []string{}
-	var calls int
+func TestLogBatchAfterClose(t *testing.T) {
+	var errs []error
+	logger, err := New(&Config{
+		Client:        new(mockClient),
+		LogGroupName:  "test",
+		ErrorReporter: func(err error) { errs = append(errs, err) },
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
 
-	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
-		actions = append(actions, action(r))
+	logger.Close()
+	logger.LogBatch([]LogEvent{{Time: time.Now(), Message: "first"}, {Time: time.Now(), Message: "second"}})
+
+	assert.Equal(t, []error{ErrClosed, ErrClosed}, errs)
+}
+
+func TestLogSync(t *testing.T) {
+	release := make(chan struct{})
+	config := &Config{
+		LogGroupName:  "test",
+		FlushInterval: 10 * time.Millisecond,
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
 		if action(r) == "PutLogEvents" {
-			calls++
-			if calls == 1 {
-				w.WriteHeader(http.StatusBadRequest)
-				w.Write([]byte(`{"__type":"ThrottlingException"}`))
-			} else {
-				var data PutLogEvents
-				parseBody(r, &data)
-				logChecker.Record(data.LogEvents)
-				stg.Write(w)
-			}
+			<-release
+			w.Write([]byte(`{"nextSequenceToken":"1"}`))
 		}
 	})
+	defer logger.Close()
 
-	logChecker.Generate(logger, 1000)
-	logger.Close()
+	result := make(chan error, 1)
+	go func() {
+		result <- logger.LogSync(context.Background(), time.Now(), "message")
+	}()
 
-	assert.Equal(t,
-		[]string{
-			"CreateLogGroup", "CreateLogStream", "PutLogEvents", "CreateLogStream",
-			"PutLogEvents",
-		},
-		actions)
+	select {
+	case <-result:
+		t.Fatal("LogSync returned before PutLogEvents completed")
+	case <-time.After(100 * time.Millisecond):
+	}
 
-	logChecker.Assert(t)
+	close(release)
+	select {
+	case err := <-result:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("LogSync did not return after PutLogEvents completed")
+	}
 }
 
-func TestConnectionFailure(t *testing.T) {
-	stg := new(SequenceTokenGenerator)
-	logChecker := NewLogChecker(1024)
-	var calls int
+func TestLogSyncReturnsWriteError(t *testing.T) {
+	config := &Config{
+		LogGroupName:  "test",
+		FlushInterval: 10 * time.Millisecond,
+		ErrorReporter: func(err error) {},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"__type": "AccessDeniedException", "message": "not authorized"}`))
+		}
+	})
+	defer logger.Close()
+
+	err := logger.LogSync(context.Background(), time.Now(), "message")
 
+	assert.Equal(t, Error{Code: "AccessDeniedException", Message: "not authorized"}, err)
+}
+
+func TestLogSyncContextDeadline(t *testing.T) {
+	release := make(chan struct{})
 	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
 		if action(r) == "PutLogEvents" {
-			calls++
-			if calls == 1 {
-				hj, _ := w.(http.Hijacker)
-				conn, _, _ := hj.Hijack()
-				conn.Close()
-			} else {
-				var data PutLogEvents
-				parseBody(r, &data)
-				logChecker.Record(data.LogEvents)
-				stg.Write(w)
-			}
+			<-release
 		}
 	})
+	defer logger.Close()
+	defer close(release)
 
-	logChecker.Generate(logger, 1000)
-	logger.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := logger.LogSync(ctx, time.Now(), "message")
 
-	logChecker.Assert(t)
+	assert.Equal(t, context.DeadlineExceeded, err)
 }
 
-func TestLogStreamCreationFailureAfterThrottlingException(t *testing.T) {
-	stg := new(SequenceTokenGenerator)
-	logChecker := NewLogChecker(1024)
-	actions := []string{}
-	var calls int
+func TestFlushContextDeadline(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
 
 	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
-		actions = append(actions, action(r))
-		calls++
-		if action(r) == "CreateLogStream" && calls == 4 {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(`{"__type":"ServiceUnavailableException"}`))
-		}
 		if action(r) == "PutLogEvents" {
-			if calls == 3 || calls == 5 {
-				w.WriteHeader(http.StatusBadRequest)
-				w.Write([]byte(`{"__type":"ThrottlingException"}`))
-			} else {
-				var data PutLogEvents
-				parseBody(r, &data)
-				logChecker.Record(data.LogEvents)
-				stg.Write(w)
-			}
+			<-release
 		}
 	})
 
-	logChecker.Generate(logger, 1000)
-	logger.Close()
+	logger.Log(time.Now(), "message")
 
-	assert.Equal(t,
-		[]string{
-			"CreateLogGroup", "CreateLogStream", "PutLogEvents", "CreateLogStream",
-			"PutLogEvents", "CreateLogStream", "PutLogEvents"},
-		actions)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
 
-	logChecker.Assert(t)
+	assert.Equal(t, context.DeadlineExceeded, logger.FlushContext(ctx))
 }
 
-func TestInvalidJSONResponses(t *testing.T) {
-	stg := new(SequenceTokenGenerator)
-	logChecker := NewLogChecker(1024)
-	var calls int
+func TestFlushAsync(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var messages []string
 
 	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
 		if action(r) == "PutLogEvents" {
-			calls++
-			if calls == 1 {
-				w.WriteHeader(http.StatusInternalServerError)
-				w.Write([]byte("invalid"))
-			} else if calls == 2 {
-				w.WriteHeader(http.StatusOK)
-				w.Write([]byte("invalid"))
-			} else {
-				var data PutLogEvents
-				parseBody(r, &data)
-				logChecker.Record(data.LogEvents)
-				stg.Write(w)
+			<-release
+			var data PutLogEvents
+			parseBody(r, &data)
+			mu.Lock()
+			for _, event := range data.LogEvents {
+				messages = append(messages, event.Message)
 			}
+			mu.Unlock()
 		}
 	})
+	defer logger.Close()
+
+	logger.Log(time.Now(), "message")
+	flushed := logger.FlushAsync()
+
+	select {
+	case <-flushed:
+		t.Fatal("flush completed before the log message was written")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case err, ok := <-flushed:
+		assert.True(t, ok)
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("flush did not complete")
+	}
+	_, ok := <-flushed
+	assert.False(t, ok, "channel not closed after the flush")
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"message"}, messages)
+}
+
+func TestFlushAsyncReportsDroppedBatches(t *testing.T) {
+	client := &failingClient{mockClient: new(mockClient), failing: true}
+	logger, err := New(&Config{
+		Client:       client,
+		LogGroupName: "test",
+		MaxRetries:   -1,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer logger.Close()
 
-	logChecker.Generate(logger, 1000)
-	logger.Close()
+	logger.Log(time.Now(), "dropped")
+	err = <-logger.FlushAsync()
+	var dropped *DroppedBatchError
+	if assert.True(t, errors.As(err, &dropped), "%v", err) {
+		assert.Len(t, dropped.LogEvents, 1)
+	}
+	assert.Contains(t, err.Error(), "ServiceUnavailableException")
+
+	// Errors reported before the flush started aren't delivered to it.
+	client.mu.Lock()
+	client.failing = false
+	client.mu.Unlock()
+	logger.Log(time.Now(), "written")
+	assert.NoError(t, <-logger.FlushAsync())
+}
 
-	logChecker.Assert(t)
+func TestWaitUntilIdle(t *testing.T) {
+	client := new(mockClient)
+	logger, err := New(&Config{
+		Client:        client,
+		LogGroupName:  "test",
+		LogStreamName: "stream",
+		FlushInterval: 50 * time.Millisecond,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer logger.Close()
+
+	// Nothing has been logged yet, so the Logger is already idle.
+	assert.NoError(t, logger.WaitUntilIdle(context.Background()))
+
+	for _, message := range []string{"first", "second", "third"} {
+		logger.Log(time.Now(), message)
+	}
+	assert.NoError(t, logger.WaitUntilIdle(context.Background()))
+
+	client.mu.Lock()
+	assert.Equal(t, []string{"first", "second", "third"}, client.messages["stream"])
+	client.mu.Unlock()
+
+	// The log messages were sent in a single batch once the flush interval
+	// elapsed, rather than being flushed early.
+	stats := logger.Stats()
+	assert.EqualValues(t, 3, stats.EventsAccepted)
+	assert.EqualValues(t, 1, stats.BatchesSent)
+	assert.EqualValues(t, 0, stats.EventsDropped)
 }
 
-func TestBatchByteSizeLimit(t *testing.T) {
-	stg := new(SequenceTokenGenerator)
-	logChecker := NewLogChecker(1024)
+func TestWaitUntilIdleContextDeadline(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
 
 	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
 		if action(r) == "PutLogEvents" {
-			var data PutLogEvents
-			parseBody(r, &data)
-			logChecker.Record(data.LogEvents)
-			assert.Len(t, data.LogEvents, 1024)
-			stg.Write(w)
+			<-release
 		}
 	})
 
-	logChecker.Generate(logger, 3072)
-	logger.Close()
+	logger.Log(time.Now(), "message")
 
-	logChecker.Assert(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	assert.Equal(t, context.DeadlineExceeded, logger.WaitUntilIdle(ctx))
 }
 
-func TestBatchLengthLimit(t *testing.T) {
-	stg := new(SequenceTokenGenerator)
-	logChecker := NewLogChecker(55)
+func TestDoubleClose(t *testing.T) {
+	var calls int
 
 	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
 		if action(r) == "PutLogEvents" {
-			var data PutLogEvents
-			parseBody(r, &data)
-			logChecker.Record(data.LogEvents)
-			assert.Len(t, data.LogEvents, 10000)
-			stg.Write(w)
+			calls++
+			w.Write([]byte(`{"nextSequenceToken":"1"}`))
 		}
 	})
 
-	logChecker.Generate(logger, 30000)
-	logger.Close()
-
-	logChecker.Assert(t)
+	logger.Log(time.Now(), "message")
+	assert.NotPanics(t, func() {
+		logger.Close()
+		logger.Close()
+		assert.NoError(t, logger.CloseContext(context.Background()))
+	})
+	assert.Equal(t, 1, calls)
 }
 
-func TestBatchSendsDataAfterTimeout(t *testing.T) {
-	stg := new(SequenceTokenGenerator)
-	logChecker := NewLogChecker(1024)
-	var wg sync.WaitGroup
-
+func TestCloseWaitsForFirstClose(t *testing.T) {
+	release := make(chan struct{})
 	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
 		if action(r) == "PutLogEvents" {
-			var data PutLogEvents
-			parseBody(r, &data)
-			logChecker.Record(data.LogEvents)
-			stg.Write(w)
-			wg.Done()
+			<-release
+			w.Write([]byte(`{"nextSequenceToken":"1"}`))
 		}
 	})
 
-	wg.Add(2)
-	logChecker.Generate(logger, 2000)
-	wg.Wait()
+	logger.Log(time.Now(), "message")
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, logger.CloseContext(ctx))
 
-	logChecker.Assert(t)
+	// A later call waits for the first one to finish draining.
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, logger.CloseContext(ctx))
+
+	close(release)
+	logger.Close()
+	assert.Equal(t, 0, logger.Pending())
+	assert.NoError(t, logger.CloseContext(context.Background()))
+}
+
+func TestLogAfterClose(t *testing.T) {
+	var reported []error
+	config := &Config{
+		LogGroupName: "test",
+		ErrorReporter: func(err error) {
+			reported = append(reported, err)
+		},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {})
+	logger.Close()
+
+	assert.NotPanics(t, func() {
+		assert.Equal(t, ErrClosed, logger.LogE(time.Now(), "message"))
+		logger.Log(time.Now(), "message")
+	})
+	assert.Equal(t, []error{ErrClosed}, reported)
 }
 
 func TestLogGroupCreationFails(t *testing.T) {
@@ -473,6 +2352,38 @@ func TestPutRetentionPolicyFails(t *testing.T) {
 	assert.Nil(t, logger)
 }
 
+func TestRandomPrefixFailure(t *testing.T) {
+	randReader = failingReader{}
+	defer func() { randReader = rand.Reader }()
+
+	var calls int
+	client := newClientWithServer(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	})
+	logger, err := New(&Config{
+		Client:       client,
+		LogGroupName: "test",
+	})
+
+	assert.Nil(t, logger)
+	assert.EqualError(t, err, "cwlogger: unable to generate log stream prefix: entropy exhausted")
+	assert.Equal(t, 0, calls)
+}
+
+func TestNewWithCancelledContext(t *testing.T) {
+	client := newClientWithServer(func(w http.ResponseWriter, r *http.Request) {})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	logger, err := NewWithContext(ctx, &Config{
+		Client:       client,
+		LogGroupName: "test",
+	})
+
+	assert.Nil(t, logger)
+	assert.True(t, errors.Is(err, context.Canceled), "expected wrapped context.Canceled, got %v", err)
+}
+
 func TestIgnoresBatchItCannotRetry(t *testing.T) {
 	var calls int
 
@@ -480,7 +2391,7 @@ func TestIgnoresBatchItCannotRetry(t *testing.T) {
 		if action(r) == "PutLogEvents" {
 			calls++
 			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte(`{"__type": "ResourceNotFoundException"}`))
+			w.Write([]byte(`{"__type": "InvalidParameterException"}`))
 		}
 	})
 
@@ -490,6 +2401,33 @@ func TestIgnoresBatchItCannotRetry(t *testing.T) {
 	assert.Equal(t, 1, calls)
 }
 
+func TestSuccessReporter(t *testing.T) {
+	var mu sync.Mutex
+	var events, bytes []int
+	config := &Config{
+		LogGroupName: "test",
+		SuccessReporter: func(n int, size int) {
+			mu.Lock()
+			events = append(events, n)
+			bytes = append(bytes, size)
+			mu.Unlock()
+		},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {})
+
+	logger.Log(time.Now(), "first")
+	logger.Log(time.Now(), "second")
+	logger.Flush()
+	logger.Log(time.Now(), "third")
+	logger.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []int{2, 1}, events)
+	assert.Equal(t, []int{eventSize("first") + eventSize("second"), eventSize("third")}, bytes)
+}
+
 func TestCustomErrorReporter(t *testing.T) {
 	var calls int
 	var errorMessages []string
@@ -506,7 +2444,7 @@ func TestCustomErrorReporter(t *testing.T) {
 			calls++
 			w.WriteHeader(http.StatusBadRequest)
 			if calls == 1 {
-				w.Write([]byte(`{"__type": "ResourceNotFoundException"}`))
+				w.Write([]byte(`{"__type": "InvalidParameterException"}`))
 			} else {
 				w.Write([]byte(`
 					{
@@ -521,8 +2459,283 @@ func TestCustomErrorReporter(t *testing.T) {
 	logChecker.Generate(logger, 2000)
 	logger.Close()
 
-	assert.Equal(t, "ResourceNotFoundException", errorMessages[0])
-	assert.Equal(t, "UnknownError: unknown", errorMessages[1])
+	assert.True(t, strings.HasSuffix(errorMessages[0], ": InvalidParameterException"), errorMessages[0])
+	assert.True(t, strings.HasSuffix(errorMessages[1], ": UnknownError: unknown"), errorMessages[1])
+}
+
+func TestOnError(t *testing.T) {
+	withoutJitter(t, time.Millisecond)
+
+	var mu sync.Mutex
+	var events []ErrorEvent
+	var reported []error
+	config := &Config{
+		LogGroupName:  "test",
+		LogStreamName: "stream",
+		MaxRetries:    1,
+		OnError: func(ev ErrorEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, ev)
+		},
+		ErrorReporter: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			reported = append(reported, err)
+		},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"__type":"ServiceUnavailableException"}`))
+		}
+	})
+
+	logger.Log(time.Now(), "first")
+	logger.Log(time.Now(), "second")
+	logger.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, PhaseRetry, events[0].Phase)
+		assert.Equal(t, "stream", events[0].Stream)
+		assert.Equal(t, 2, events[0].Events)
+		var apiErr Error
+		assert.True(t, errors.As(events[0].Err, &apiErr))
+		assert.Equal(t, "ServiceUnavailableException", apiErr.Code)
+
+		assert.Equal(t, PhaseDrop, events[1].Phase)
+		assert.Equal(t, "stream", events[1].Stream)
+		assert.Equal(t, 2, events[1].Events)
+		var dropped *DroppedBatchError
+		assert.True(t, errors.As(events[1].Err, &dropped))
+
+		// The ErrorReporter isn't told about the retry.
+		assert.Equal(t, []error{events[1].Err}, reported)
+	}
+}
+
+func TestOnErrorEnqueue(t *testing.T) {
+	var events []ErrorEvent
+	config := &Config{
+		LogGroupName: "test",
+		OnError: func(ev ErrorEvent) {
+			events = append(events, ev)
+		},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {})
+	logger.Log(time.Now(), "")
+	logger.Close()
+
+	assert.Equal(t, []ErrorEvent{{Phase: PhaseEnqueue, Events: 1, Err: ErrEmptyMessage}}, events)
+}
+func TestUnknownErrorIsReported(t *testing.T) {
+	var reported []error
+	config := &Config{
+		LogGroupName: "test",
+		ErrorReporter: func(err error) {
+			reported = append(reported, err)
+		},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`
+				{
+					"__type": "AccessDeniedException",
+					"message": "not authorized"
+				}
+			`))
+		}
+	})
+
+	assert.NotPanics(t, func() {
+		logger.Log(time.Now(), "message")
+		logger.Close()
+	})
+
+	if assert.Len(t, reported, 1) {
+		var ownErr Error
+		assert.True(t, errors.As(reported[0], &ownErr))
+		assert.Equal(t, Error{Code: "AccessDeniedException", Message: "not authorized"}, ownErr)
+	}
+}
+
+func TestStats(t *testing.T) {
+	stg := new(SequenceTokenGenerator)
+	logChecker := NewLogChecker(1024)
+
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			stg.Write(w)
+		}
+	})
+
+	logChecker.Generate(logger, 2000)
+	logger.Close()
+
+	stats := logger.Stats()
+	assert.EqualValues(t, 2000, stats.EventsAccepted)
+	assert.EqualValues(t, 0, stats.EventsDropped)
+	assert.EqualValues(t, 2, stats.BatchesSent)
+	assert.EqualValues(t, 0, stats.BatchesRetried)
+	assert.EqualValues(t, 2000*1024, stats.BytesSent)
+	assert.EqualValues(t, 1, stats.CurrentStreams)
+}
+
+func TestStatsCountsRetriesAndDrops(t *testing.T) {
+	var calls int
+
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			calls++
+			w.WriteHeader(http.StatusBadRequest)
+			if calls == 1 {
+				w.Write([]byte(`{"__type": "ServiceUnavailableException"}`))
+			} else {
+				w.Write([]byte(`{"__type": "InvalidParameterException"}`))
+			}
+		}
+	})
+
+	logger.Log(time.Now(), "message")
+	logger.Log(time.Now(), "message")
+	logger.Close()
+
+	stats := logger.Stats()
+	assert.EqualValues(t, 2, stats.EventsAccepted)
+	assert.EqualValues(t, 2, stats.EventsDropped)
+	assert.EqualValues(t, 0, stats.BatchesSent)
+	assert.EqualValues(t, 1, stats.BatchesRetried)
+}
+
+func TestConfigRetention(t *testing.T) {
+	for _, days := range []int{0, 1, 14, 90, 365, 3653} {
+		_, err := New(&Config{
+			Client:       newClientWithServer(func(w http.ResponseWriter, r *http.Request) {}),
+			LogGroupName: "test",
+			Retention:    days,
+		})
+		assert.NoError(t, err, "retention %d", days)
+	}
+
+	for _, days := range []int{-1, 2, 100, 366, 10000} {
+		var calls int
+		logger, err := New(&Config{
+			Client: newClientWithServer(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+			}),
+			LogGroupName: "test",
+			Retention:    days,
+		})
+		assert.Nil(t, logger)
+		assert.True(t, errors.Is(err, ErrInvalidRetention), "retention %d: %v", days, err)
+		assert.Equal(t, 0, calls)
+	}
+}
+
+func TestClientOptions(t *testing.T) {
+	var defaultActions, stubActions []string
+	client := newClientWithServer(func(w http.ResponseWriter, r *http.Request) {
+		defaultActions = append(defaultActions, action(r))
+	})
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stubActions = append(stubActions, action(r))
+		if action(r) == "PutLogEvents" {
+			w.Write([]byte(`{"nextSequenceToken":"1"}`))
+		}
+	}))
+	defer stub.Close()
+
+	logger, err := New(&Config{
+		Client:       client,
+		LogGroupName: "test",
+		ClientOptions: []func(*cloudwatchlogs.Options){
+			func(o *cloudwatchlogs.Options) {
+				o.EndpointResolver = cloudwatchlogs.EndpointResolverFunc(
+					func(region string, options cloudwatchlogs.EndpointResolverOptions) (aws.Endpoint, error) {
+						return aws.Endpoint{URL: stub.URL}, nil
+					},
+				)
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	logger.Log(time.Now(), "message")
+	logger.Close()
+
+	assert.Empty(t, defaultActions)
+	assert.Equal(t, []string{"CreateLogGroup", "CreateLogStream", "PutLogEvents"}, stubActions)
+}
+
+func TestHealthCheck(t *testing.T) {
+	var data struct {
+		LogGroupName        string `json:"logGroupName"`
+		LogStreamNamePrefix string `json:"logStreamNamePrefix"`
+	}
+
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "DescribeLogStreams" {
+			parseBody(r, &data)
+			w.Write([]byte(`{"logStreams":[]}`))
+		}
+	})
+	defer logger.Close()
+
+	assert.NoError(t, logger.HealthCheck(context.Background()))
+	assert.Equal(t, "test", data.LogGroupName)
+	assert.Equal(t, logger.StreamNames()[0], data.LogStreamNamePrefix)
+}
+
+func TestHealthCheckAccessDenied(t *testing.T) {
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "DescribeLogStreams" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`
+				{
+					"__type": "AccessDeniedException",
+					"message": "not authorized to perform logs:DescribeLogStreams"
+				}
+			`))
+		}
+	})
+	defer logger.Close()
+
+	err := logger.HealthCheck(context.Background())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `health check failed for log group "test"`)
+		assert.Contains(t, err.Error(), "AccessDeniedException")
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	var calls int
+	config := &Config{
+		LogGroupName: "test",
+		Streams:      2,
+		DryRun:       true,
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	})
+
+	logger.Log(time.Now(), "first")
+	logger.Flush()
+	logger.Log(time.Now(), "second")
+	logger.Close()
+
+	assert.Equal(t, 0, calls)
+	assert.Len(t, logger.StreamNames(), 2)
+	stats := logger.Stats()
+	assert.EqualValues(t, 2, stats.EventsAccepted)
+	assert.EqualValues(t, 2, stats.BatchesSent)
+	assert.EqualValues(t, eventSize("first")+eventSize("second"), stats.BytesSent)
 }
 
 func TestConfigWithoutClient(t *testing.T) {
@@ -542,7 +2755,10 @@ func TestConfigWithoutLogGroupName(t *testing.T) {
 }
 
 type CreateLogGroup struct {
-	LogGroupName string `json:"logGroupName"`
+	LogGroupName  string            `json:"logGroupName"`
+	KmsKeyID      *string           `json:"kmsKeyId"`
+	Tags          map[string]string `json:"tags"`
+	LogGroupClass *string           `json:"logGroupClass"`
 }
 
 type CreateLogStream struct {
@@ -551,18 +2767,18 @@ type CreateLogStream struct {
 }
 
 type PutLogEvents struct {
-	LogGroupName  string      `json:"logGroupName"`
-	LogStreamName string      `json:"logStreamName"`
-	SequenceToken *string     `json:"sequenceToken"`
-	LogEvents     []*LogEvent `json:"logEvents"`
+	LogGroupName  string           `json:"logGroupName"`
+	LogStreamName string           `json:"logStreamName"`
+	SequenceToken *string          `json:"sequenceToken"`
+	LogEvents     []*InputLogEvent `json:"logEvents"`
 }
 
 type PutRetentionPolicy struct {
 	LogGroupName    string `json:"logGroupName"`
-	RetentionInDays string `json:"retentionInDays"`
+	RetentionInDays int    `json:"retentionInDays"`
 }
 
-type LogEvent struct {
+type InputLogEvent struct {
 	Timestamp int64  `json:"timestamp"`
 	Message   string `json:"message"`
 }
@@ -634,6 +2850,12 @@ func parseBody(r *http.Request, target interface{}) {
 	json.Unmarshal(b, target)
 }
 
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("entropy exhausted")
+}
+
 type SequenceTokenGenerator struct {
 	token int
 }
@@ -712,7 +2934,7 @@ func (c *LogChecker) Generate(lg *Logger, count int) {
 	}
 }
 
-func (c *LogChecker) Record(events []*LogEvent) {
+func (c *LogChecker) Record(events []*InputLogEvent) {
 	for _, event := range events {
 		var message TestLogMessage
 		err := json.Unmarshal([]byte(event.Message), &message)
@@ -728,3 +2950,21 @@ func (c *LogChecker) Assert(t *testing.T) {
 	sort.Sort(c.recorded)
 	assert.Equal(t, c.generated, c.recorded)
 }
+
+func BenchmarkLog(b *testing.B) {
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			w.Write([]byte(`{"nextSequenceToken":"1"}`))
+		}
+	})
+	t := time.Now()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Log(t, "benchmark message")
+	}
+	b.StopTimer()
+
+	logger.Close()
+}
@@ -0,0 +1,94 @@
+// Package cwloggerotel records OpenTelemetry metrics for a cwlogger.Logger.
+//
+// # Usage
+//
+// Apply WithMeterProvider to the Config before creating the Logger.
+//
+//	config := &cwlogger.Config{
+//		Client:       client,
+//		LogGroupName: "groupName",
+//	}
+//	cwloggerotel.WithMeterProvider(otel.GetMeterProvider())(config)
+//	logger, err := cwlogger.New(config)
+package cwloggerotel
+
+import (
+	"context"
+	"time"
+
+	"github.com/jwoffindin/cwlogger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const instrumentationName = "github.com/jwoffindin/cwlogger/cwloggerotel"
+
+// WithMeterProvider returns an Option that sets the Observer of a Config to
+// record metrics with a meter from mp:
+//
+//   - cwlogger.events.accepted: log events accepted for writing
+//   - cwlogger.batches: PutLogEvents calls, with a boolean "success" attribute
+//   - cwlogger.batch.size: the size of each batch in bytes
+//   - cwlogger.put_log_events.duration: the duration of PutLogEvents calls
+//
+// Metrics are attributed with the Config's LogGroupName, so it should be set
+// before the returned Option is applied. Errors creating instruments are
+// passed to the global OpenTelemetry error handler.
+func WithMeterProvider(mp metric.MeterProvider) cwlogger.Option {
+	return func(config *cwlogger.Config) {
+		config.Observer = newObserver(mp.Meter(instrumentationName), config.LogGroupName)
+	}
+}
+
+type observer struct {
+	eventsAccepted metric.Int64Counter
+	batches        metric.Int64Counter
+	batchSize      metric.Int64Histogram
+	duration       metric.Float64Histogram
+	attrs          attribute.Set
+}
+
+func newObserver(meter metric.Meter, logGroupName string) *observer {
+	o := &observer{
+		attrs: attribute.NewSet(attribute.String("log_group", logGroupName)),
+	}
+
+	var err error
+	o.eventsAccepted, err = meter.Int64Counter("cwlogger.events.accepted",
+		metric.WithDescription("Log events accepted for writing."),
+		metric.WithUnit("{event}"))
+	handle(err)
+	o.batches, err = meter.Int64Counter("cwlogger.batches",
+		metric.WithDescription("Batches of log events written with PutLogEvents."),
+		metric.WithUnit("{batch}"))
+	handle(err)
+	o.batchSize, err = meter.Int64Histogram("cwlogger.batch.size",
+		metric.WithDescription("Size of batches written with PutLogEvents."),
+		metric.WithUnit("By"))
+	handle(err)
+	o.duration, err = meter.Float64Histogram("cwlogger.put_log_events.duration",
+		metric.WithDescription("Duration of PutLogEvents calls."),
+		metric.WithUnit("s"))
+	handle(err)
+
+	return o
+}
+
+func handle(err error) {
+	if err != nil {
+		otel.Handle(err)
+	}
+}
+
+func (o *observer) LogEventsAccepted(n int) {
+	o.eventsAccepted.Add(context.Background(), int64(n), metric.WithAttributeSet(o.attrs))
+}
+
+func (o *observer) PutLogEvents(events, bytes int, d time.Duration, err error) {
+	ctx := context.Background()
+	attrs := metric.WithAttributeSet(o.attrs)
+	o.batches.Add(ctx, 1, attrs, metric.WithAttributes(attribute.Bool("success", err == nil)))
+	o.batchSize.Record(ctx, int64(bytes), attrs)
+	o.duration.Record(ctx, d.Seconds(), attrs)
+}
@@ -0,0 +1,85 @@
+package cwloggerotel
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/jwoffindin/cwlogger"
+	"github.com/stretchr/testify/assert"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestWithMeterProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.Header.Get("X-Amz-Target"), ".PutLogEvents") {
+			w.Write([]byte(`{"nextSequenceToken":"1"}`))
+		}
+	}))
+	defer server.Close()
+
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	config := &cwlogger.Config{
+		Client:       newClient(server.URL),
+		LogGroupName: "test",
+	}
+	WithMeterProvider(mp)(config)
+
+	logger, err := cwlogger.New(config)
+	if !assert.NoError(t, err) {
+		return
+	}
+	logger.Log(time.Now(), "first")
+	logger.Log(time.Now(), "second")
+	logger.Close()
+
+	var rm metricdata.ResourceMetrics
+	assert.NoError(t, reader.Collect(context.Background(), &rm))
+
+	metrics := map[string]metricdata.Aggregation{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+
+	if accepted, ok := metrics["cwlogger.events.accepted"].(metricdata.Sum[int64]); assert.True(t, ok) {
+		assert.EqualValues(t, 2, accepted.DataPoints[0].Value)
+	}
+	if batches, ok := metrics["cwlogger.batches"].(metricdata.Sum[int64]); assert.True(t, ok) {
+		assert.EqualValues(t, 1, batches.DataPoints[0].Value)
+	}
+	if size, ok := metrics["cwlogger.batch.size"].(metricdata.Histogram[int64]); assert.True(t, ok) {
+		assert.EqualValues(t, 1, size.DataPoints[0].Count)
+		assert.EqualValues(t, 2*26+len("first")+len("second"), size.DataPoints[0].Sum)
+	}
+	if duration, ok := metrics["cwlogger.put_log_events.duration"].(metricdata.Histogram[float64]); assert.True(t, ok) {
+		assert.EqualValues(t, 1, duration.DataPoints[0].Count)
+	}
+}
+
+func newClient(url string) *cloudwatchlogs.Client {
+	return cloudwatchlogs.New(cloudwatchlogs.Options{
+		Region:      "us-east-1",
+		Credentials: aws.NewCredentialsCache(staticCredentials{}),
+		EndpointResolver: cloudwatchlogs.EndpointResolverFunc(
+			func(region string, options cloudwatchlogs.EndpointResolverOptions) (aws.Endpoint, error) {
+				return aws.Endpoint{URL: url}, nil
+			},
+		),
+	})
+}
+
+type staticCredentials struct{}
+
+func (staticCredentials) Retrieve(context.Context) (aws.Credentials, error) {
+	return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET", Source: "staticCredentials"}, nil
+}
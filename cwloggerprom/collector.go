@@ -0,0 +1,94 @@
+// Package cwloggerprom exposes the statistics of a cwlogger.Logger as
+// Prometheus metrics.
+//
+// # Usage
+//
+// Register a Collector for the Logger with a Prometheus registry.
+//
+//	prometheus.MustRegister(cwloggerprom.NewCollector(logger, nil))
+package cwloggerprom
+
+import (
+	"github.com/jwoffindin/cwlogger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector is a prometheus.Collector that exposes the Stats of a Logger.
+// Every metric is labelled with the name of the Logger's log group.
+type Collector struct {
+	logger *cwlogger.Logger
+
+	eventsAccepted *prometheus.Desc
+	eventsDropped  *prometheus.Desc
+	batchesSent    *prometheus.Desc
+	batchesRetried *prometheus.Desc
+	bytesSent      *prometheus.Desc
+	queuedEvents   *prometheus.Desc
+	streams        *prometheus.Desc
+	tokenErrors    *prometheus.Desc
+	duplicates     *prometheus.Desc
+	quarantined    *prometheus.Desc
+}
+
+// NewCollector creates a Collector for lg. The optional constLabels are added
+// to every metric.
+func NewCollector(lg *cwlogger.Logger, constLabels prometheus.Labels) *Collector {
+	labels := prometheus.Labels{"log_group": lg.LogGroupName()}
+	for k, v := range constLabels {
+		labels[k] = v
+	}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("cwlogger_"+name, help, nil, labels)
+	}
+
+	return &Collector{
+		logger:         lg,
+		eventsAccepted: desc("events_accepted_total", "Log events accepted for writing."),
+		eventsDropped:  desc("events_dropped_total", "Log events rejected or not written to CloudWatch Logs."),
+		batchesSent:    desc("batches_sent_total", "Batches written with PutLogEvents."),
+		batchesRetried: desc("batches_retried_total", "Failed batches that were retried."),
+		bytesSent:      desc("bytes_sent_total", "Bytes written to CloudWatch Logs."),
+		queuedEvents:   desc("queued_events", "Log events waiting in the queue to be batched."),
+		streams:        desc("streams", "Log streams being written to."),
+		tokenErrors:    desc("invalid_token_recoveries_total", "PutLogEvents calls rejected with an invalid sequence token."),
+		duplicates:     desc("duplicate_batches_total", "PutLogEvents calls rejected as already accepted."),
+		quarantined:    desc("streams_quarantined_total", "Log streams replaced after repeated failed writes."),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.eventsAccepted
+	ch <- c.eventsDropped
+	ch <- c.batchesSent
+	ch <- c.batchesRetried
+	ch <- c.bytesSent
+	ch <- c.queuedEvents
+	ch <- c.streams
+	ch <- c.tokenErrors
+	ch <- c.duplicates
+	ch <- c.quarantined
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.logger.Stats()
+
+	counter := func(desc *prometheus.Desc, v int64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(v))
+	}
+	gauge := func(desc *prometheus.Desc, v int64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(v))
+	}
+
+	counter(c.eventsAccepted, stats.EventsAccepted)
+	counter(c.eventsDropped, stats.EventsDropped)
+	counter(c.batchesSent, stats.BatchesSent)
+	counter(c.batchesRetried, stats.BatchesRetried)
+	counter(c.bytesSent, stats.BytesSent)
+	gauge(c.queuedEvents, stats.QueuedEvents)
+	gauge(c.streams, stats.CurrentStreams)
+	counter(c.tokenErrors, stats.InvalidTokenRecoveries)
+	counter(c.duplicates, stats.DuplicateBatches)
+	counter(c.quarantined, stats.StreamsQuarantined)
+}
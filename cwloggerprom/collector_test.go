@@ -0,0 +1,90 @@
+package cwloggerprom
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/jwoffindin/cwlogger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.Header.Get("X-Amz-Target"), ".PutLogEvents") {
+			w.Write([]byte(`{"nextSequenceToken":"1"}`))
+		}
+	}))
+	defer server.Close()
+
+	client := cloudwatchlogs.New(cloudwatchlogs.Options{
+		Region:      "us-east-1",
+		Credentials: aws.NewCredentialsCache(staticCredentials{}),
+		EndpointResolver: cloudwatchlogs.EndpointResolverFunc(
+			func(region string, options cloudwatchlogs.EndpointResolverOptions) (aws.Endpoint, error) {
+				return aws.Endpoint{URL: server.URL}, nil
+			},
+		),
+	})
+
+	logger, err := cwlogger.New(&cwlogger.Config{
+		Client:       client,
+		LogGroupName: "test",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	logger.Log(time.Now(), "0123456789")
+	logger.Log(time.Now(), "0123456789")
+	logger.Log(time.Now().Add(-30*24*time.Hour), "too old")
+	logger.Close()
+
+	collector := NewCollector(logger, prometheus.Labels{"app": "api"})
+	expected := `
+# HELP cwlogger_batches_retried_total Failed batches that were retried.
+# TYPE cwlogger_batches_retried_total counter
+cwlogger_batches_retried_total{app="api",log_group="test"} 0
+# HELP cwlogger_batches_sent_total Batches written with PutLogEvents.
+# TYPE cwlogger_batches_sent_total counter
+cwlogger_batches_sent_total{app="api",log_group="test"} 1
+# HELP cwlogger_bytes_sent_total Bytes written to CloudWatch Logs.
+# TYPE cwlogger_bytes_sent_total counter
+cwlogger_bytes_sent_total{app="api",log_group="test"} 72
+# HELP cwlogger_duplicate_batches_total PutLogEvents calls rejected as already accepted.
+# TYPE cwlogger_duplicate_batches_total counter
+cwlogger_duplicate_batches_total{app="api",log_group="test"} 0
+# HELP cwlogger_events_accepted_total Log events accepted for writing.
+# TYPE cwlogger_events_accepted_total counter
+cwlogger_events_accepted_total{app="api",log_group="test"} 2
+# HELP cwlogger_events_dropped_total Log events rejected or not written to CloudWatch Logs.
+# TYPE cwlogger_events_dropped_total counter
+cwlogger_events_dropped_total{app="api",log_group="test"} 1
+# HELP cwlogger_invalid_token_recoveries_total PutLogEvents calls rejected with an invalid sequence token.
+# TYPE cwlogger_invalid_token_recoveries_total counter
+cwlogger_invalid_token_recoveries_total{app="api",log_group="test"} 0
+# HELP cwlogger_queued_events Log events waiting in the queue to be batched.
+# TYPE cwlogger_queued_events gauge
+cwlogger_queued_events{app="api",log_group="test"} 0
+# HELP cwlogger_streams Log streams being written to.
+# TYPE cwlogger_streams gauge
+cwlogger_streams{app="api",log_group="test"} 1
+# HELP cwlogger_streams_quarantined_total Log streams replaced after repeated failed writes.
+# TYPE cwlogger_streams_quarantined_total counter
+cwlogger_streams_quarantined_total{app="api",log_group="test"} 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected)))
+}
+
+type staticCredentials struct{}
+
+func (staticCredentials) Retrieve(context.Context) (aws.Credentials, error) {
+	return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET", Source: "staticCredentials"}, nil
+}
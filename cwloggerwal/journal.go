@@ -0,0 +1,372 @@
+// Package cwloggerwal adds a write-ahead journal to a cwlogger.Logger, so that
+// log messages accepted but not yet written to CloudWatch Logs survive a crash
+// of the process.
+//
+// Every log message is appended to a journal file in PersistDir before it is
+// enqueued. Whenever the Logger has no log messages pending, the journal is
+// truncated. When a Logger is created, log messages left in the journal by a
+// previous process are logged again, so log messages that were written just
+// before a crash may be written twice.
+//
+// The journal is compressed with gzip unless configured otherwise. Journals
+// are replayed whether they're compressed or not, so the Compression can be
+// changed between processes.
+//
+// # Usage
+//
+//	logger, err := cwloggerwal.New(&cwloggerwal.Config{
+//		Config: cwlogger.Config{
+//			Client:       client,
+//			LogGroupName: "groupName",
+//		},
+//		PersistDir: "/var/lib/myapp/logs",
+//	})
+package cwloggerwal
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jwoffindin/cwlogger"
+)
+
+// journalName is the name of the journal file in PersistDir.
+const journalName = "cwlogger.journal"
+
+// Compression determines how the journal is compressed.
+type Compression int
+
+const (
+	// GzipCompression compresses the journal with gzip, flushing the
+	// compressor after every log message so that it survives a crash.
+	GzipCompression Compression = iota
+
+	// NoCompression writes the journal as uncompressed JSON lines.
+	NoCompression
+)
+
+// The Config for the Logger.
+type Config struct {
+	cwlogger.Config
+
+	// The directory to keep the journal in, which must be writable and not
+	// shared with any other Logger. Required.
+	PersistDir string
+
+	// An optional Compression for the journal. Defaults to GzipCompression.
+	Compression Compression
+}
+
+// A Logger is a cwlogger.Logger that journals log messages until they're
+// written. It only offers the logging methods that journal log messages, so
+// that none can bypass the journal, and doesn't give access to the
+// cwlogger.Logger it wraps.
+type Logger struct {
+	logger *cwlogger.Logger
+
+	mu            sync.Mutex // guards appending to and truncating the journal
+	file          *os.File
+	gz            *gzip.Writer // nil if the journal is not compressed
+	enc           *json.Encoder
+	errorReporter func(err error)
+	checkpoints   chan struct{}
+	done          chan struct{}
+	closeOnce     sync.Once
+}
+
+// A record is a log message in the journal.
+type record struct {
+	Timestamp int64  `json:"timestamp"` // in milliseconds since the epoch
+	Message   string `json:"message"`
+}
+
+// New creates a new Logger like cwlogger.New, then logs the log messages left
+// in the journal by a previous Logger.
+func New(config *Config) (*Logger, error) {
+	if config.PersistDir == "" {
+		return nil, errors.New("cwloggerwal: config missing required PersistDir")
+	}
+
+	path := filepath.Join(config.PersistDir, journalName)
+	replay, err := readJournal(path)
+	if err != nil {
+		return nil, fmt.Errorf("cwloggerwal: unable to read journal: %w", err)
+	}
+	// Rewrite the journal, so that it's appended to in the configured
+	// Compression, without any partial record left by a crash.
+	if err := writeJournal(path, replay, config.Compression); err != nil {
+		return nil, fmt.Errorf("cwloggerwal: unable to rewrite journal: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("cwloggerwal: unable to open journal: %w", err)
+	}
+
+	var w io.Writer = file
+	var gz *gzip.Writer
+	if config.Compression == GzipCompression {
+		gz = gzip.NewWriter(file)
+		w = gz
+	}
+
+	l := &Logger{
+		file:          file,
+		gz:            gz,
+		enc:           json.NewEncoder(w),
+		errorReporter: config.ErrorReporter,
+		checkpoints:   make(chan struct{}, 1),
+		done:          make(chan struct{}),
+	}
+	if l.errorReporter == nil {
+		l.errorReporter = func(error) {}
+	}
+
+	inner := config.Config
+	successReporter := inner.SuccessReporter
+	inner.SuccessReporter = func(events int, bytes int) {
+		if successReporter != nil {
+			successReporter(events, bytes)
+		}
+		select {
+		case l.checkpoints <- struct{}{}:
+		default: // a checkpoint is already pending
+		}
+	}
+	l.logger, err = cwlogger.New(&inner)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	for _, r := range replay {
+		if err := l.logger.LogE(time.Unix(0, r.Timestamp*int64(time.Millisecond)), r.Message); err != nil {
+			l.errorReporter(err)
+		}
+	}
+
+	go l.checkpointer()
+	return l, nil
+}
+
+// readJournal returns the records in the journal at path, compressed or not,
+// ignoring a partial record at the end left by a crash.
+func readJournal(path string) ([]record, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	br := bufio.NewReader(file)
+	var r io.Reader = br
+	compressed := false
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil // only part of the header was written
+		}
+		r = gz
+		compressed = true
+	}
+
+	var records []record
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 2*1024*1024)
+	for scanner.Scan() {
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			break
+		}
+		records = append(records, r)
+	}
+	if compressed {
+		// A crash leaves the compressed stream cut short, which is reported
+		// as a read error once the complete records have been read.
+		return records, nil
+	}
+	return records, scanner.Err()
+}
+
+// writeJournal replaces the journal at path with one holding the records.
+func writeJournal(path string, records []record, compression Compression) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	var w io.Writer = file
+	var gz *gzip.Writer
+	if compression == GzipCompression && len(records) > 0 {
+		gz = gzip.NewWriter(file)
+		w = gz
+	}
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Log journals the log message, then enqueues it like cwlogger.Logger.Log.
+//
+// This method is safe for concurrent access by multiple goroutines.
+func (l *Logger) Log(t time.Time, s string) {
+	if err := l.LogE(t, s); err != nil {
+		l.errorReporter(err)
+	}
+}
+
+// LogCtx journals the log message, then enqueues it like
+// cwlogger.Logger.LogCtx, abandoning it if ctx is done before it is accepted
+// into the queue. Abandoned log messages stay in the journal until the next
+// checkpoint, so may be logged again by the next Logger after a crash.
+//
+// This method is safe for concurrent access by multiple goroutines.
+func (l *Logger) LogCtx(ctx context.Context, t time.Time, s string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.journal(t, s); err != nil {
+		l.errorReporter(err)
+		return
+	}
+	l.logger.LogCtx(ctx, t, s)
+}
+
+// LogE journals the log message, then enqueues it like cwlogger.Logger.LogE.
+// It returns an error without enqueuing the log message if it can't be
+// journaled.
+//
+// This method is safe for concurrent access by multiple goroutines.
+func (l *Logger) LogE(t time.Time, s string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.journal(t, s); err != nil {
+		return err
+	}
+	return l.logger.LogE(t, s)
+}
+
+// journal appends the log message to the journal. It must be called with mu
+// held, until the log message has been enqueued.
+func (l *Logger) journal(t time.Time, s string) error {
+	r := record{Timestamp: t.UnixNano() / int64(time.Millisecond), Message: s}
+	if err := l.enc.Encode(r); err != nil {
+		return fmt.Errorf("cwloggerwal: unable to journal log message: %w", err)
+	}
+	if l.gz != nil {
+		if err := l.gz.Flush(); err != nil {
+			return fmt.Errorf("cwloggerwal: unable to journal log message: %w", err)
+		}
+	}
+	return nil
+}
+
+// Flush writes the enqueued log messages like cwlogger.Logger.Flush, then
+// truncates the journal.
+func (l *Logger) Flush() {
+	l.logger.Flush()
+	l.checkpoint()
+}
+
+// FlushContext is like Flush, but gives up waiting once ctx is done, returning
+// ctx.Err() without truncating the journal.
+func (l *Logger) FlushContext(ctx context.Context) error {
+	if err := l.logger.FlushContext(ctx); err != nil {
+		return err
+	}
+	l.checkpoint()
+	return nil
+}
+
+// Stats returns a snapshot of the Logger's counters, like
+// cwlogger.Logger.Stats.
+func (l *Logger) Stats() cwlogger.Stats {
+	return l.logger.Stats()
+}
+
+// Pending returns the number of log messages accepted but not yet written or
+// dropped, like cwlogger.Logger.Pending.
+func (l *Logger) Pending() int {
+	return l.logger.Pending()
+}
+
+// Close drains and writes the enqueued log messages like
+// cwlogger.Logger.Close, then truncates and closes the journal.
+func (l *Logger) Close() {
+	l.CloseContext(context.Background())
+}
+
+// CloseContext is like Close, but gives up waiting once ctx is done, returning
+// ctx.Err(). Log messages that have not been written by then are left in the
+// journal, to be logged again by the next Logger. Like cwlogger.Logger, it may
+// be called more than once.
+func (l *Logger) CloseContext(ctx context.Context) error {
+	err := l.logger.CloseContext(ctx)
+	l.closeOnce.Do(func() { close(l.done) })
+	if err == nil {
+		l.checkpoint()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.file.Close()
+	return err
+}
+
+func (l *Logger) checkpointer() {
+	for {
+		select {
+		case <-l.checkpoints:
+			l.checkpoint()
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// checkpoint truncates the journal if every journaled log message has been
+// written or dropped.
+func (l *Logger) checkpoint() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.logger.Pending() > 0 {
+		return
+	}
+	if err := l.file.Truncate(0); err != nil && !errors.Is(err, os.ErrClosed) {
+		l.errorReporter(fmt.Errorf("cwloggerwal: unable to truncate journal: %w", err))
+		return
+	}
+	if l.gz != nil {
+		// Start a new gzip stream, with its header, on the next log message.
+		l.gz.Reset(l.file)
+	}
+}
@@ -0,0 +1,235 @@
+package cwloggerwal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/jwoffindin/cwlogger"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClient records the log messages written to it. PutLogEvents blocks while
+// blocked is open.
+type fakeClient struct {
+	cwlogger.CloudWatchLogsAPI
+
+	blocked  chan struct{}
+	mu       sync.Mutex
+	messages []string
+}
+
+func (c *fakeClient) CreateLogGroup(ctx context.Context, params *cloudwatchlogs.CreateLogGroupInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogGroupOutput, error) {
+	return &cloudwatchlogs.CreateLogGroupOutput{}, nil
+}
+
+func (c *fakeClient) CreateLogStream(ctx context.Context, params *cloudwatchlogs.CreateLogStreamInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+	return &cloudwatchlogs.CreateLogStreamOutput{}, nil
+}
+
+func (c *fakeClient) PutLogEvents(ctx context.Context, params *cloudwatchlogs.PutLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutLogEventsOutput, error) {
+	if c.blocked != nil {
+		<-c.blocked
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, event := range params.LogEvents {
+		c.messages = append(c.messages, aws.ToString(event.Message))
+	}
+	return &cloudwatchlogs.PutLogEventsOutput{}, nil
+}
+
+func newTestLogger(t *testing.T, dir string, client *fakeClient) *Logger {
+	return newTestLoggerWithCompression(t, dir, client, GzipCompression)
+}
+
+func newTestLoggerWithCompression(t *testing.T, dir string, client *fakeClient, compression Compression) *Logger {
+	logger, err := New(&Config{
+		Config: cwlogger.Config{
+			Client:        client,
+			LogGroupName:  "test",
+			FlushInterval: 10 * time.Millisecond,
+		},
+		PersistDir:  dir,
+		Compression: compression,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return logger
+}
+
+func readFile(t *testing.T, path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// journalMessages returns the log messages in the journal in dir.
+func journalMessages(t *testing.T, dir string) []string {
+	records, err := readJournal(filepath.Join(dir, journalName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []string
+	for _, r := range records {
+		messages = append(messages, r.Message)
+	}
+	return messages
+}
+
+func TestJournalIsTruncatedOnceWritten(t *testing.T) {
+	dir := t.TempDir()
+	client := &fakeClient{blocked: make(chan struct{})}
+	logger := newTestLogger(t, dir, client)
+
+	logger.Log(time.Now(), "first")
+	logger.Log(time.Now(), "second")
+
+	assert.Equal(t, []string{"first", "second"}, journalMessages(t, dir))
+
+	close(client.blocked)
+	logger.Flush()
+	assert.Empty(t, readFile(t, filepath.Join(dir, journalName)))
+
+	logger.Log(time.Now(), "third")
+	logger.Close()
+	assert.Empty(t, readFile(t, filepath.Join(dir, journalName)))
+	assert.Equal(t, []string{"first", "second", "third"}, client.messages)
+}
+
+func TestJournalIsReplayedAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	crashed := &fakeClient{blocked: make(chan struct{})}
+	defer close(crashed.blocked)
+	logger := newTestLogger(t, dir, crashed)
+
+	logger.Log(time.Now(), "first")
+	logger.Log(time.Now(), "second")
+
+	// Simulate a crash by abandoning the Logger, leaving a partial record.
+	logger.file.WriteString(`{"timestamp":`)
+	logger.file.Close()
+
+	client := new(fakeClient)
+	logger = newTestLogger(t, dir, client)
+	logger.Log(time.Now(), "third")
+	logger.Close()
+
+	assert.Equal(t, []string{"first", "second", "third"}, client.messages)
+	assert.Empty(t, crashed.messages)
+	assert.Empty(t, readFile(t, filepath.Join(dir, journalName)))
+}
+
+func TestCloseContextKeepsUnwrittenJournal(t *testing.T) {
+	dir := t.TempDir()
+	client := &fakeClient{blocked: make(chan struct{})}
+	defer close(client.blocked)
+	logger := newTestLogger(t, dir, client)
+
+	logger.Log(time.Now(), "unwritten")
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, logger.CloseContext(ctx))
+
+	assert.Equal(t, []string{"unwritten"}, journalMessages(t, dir))
+}
+
+func TestDoubleClose(t *testing.T) {
+	dir := t.TempDir()
+	client := new(fakeClient)
+	logger := newTestLogger(t, dir, client)
+
+	logger.Log(time.Now(), "message")
+	assert.NotPanics(t, func() {
+		logger.Close()
+		logger.Close()
+		assert.NoError(t, logger.CloseContext(context.Background()))
+	})
+	assert.Equal(t, []string{"message"}, client.messages)
+	assert.Empty(t, journalMessages(t, dir))
+}
+
+func TestLogCtxIsJournaled(t *testing.T) {
+	dir := t.TempDir()
+	client := &fakeClient{blocked: make(chan struct{})}
+	logger := newTestLogger(t, dir, client)
+
+	logger.LogCtx(context.Background(), time.Now(), "message")
+	assert.Equal(t, []string{"message"}, journalMessages(t, dir))
+	assert.Equal(t, 1, logger.Pending())
+
+	close(client.blocked)
+	assert.NoError(t, logger.FlushContext(context.Background()))
+	assert.Empty(t, journalMessages(t, dir))
+	assert.EqualValues(t, 1, logger.Stats().EventsAccepted)
+	logger.Close()
+}
+
+func TestCompressedJournalRoundTrip(t *testing.T) {
+	messages := []string{
+		"first",
+		strings.Repeat("a highly compressible log message ", 1000),
+		"ünïcödé ✓",
+	}
+
+	for _, tc := range []struct {
+		name        string
+		compression Compression
+		gzipped     bool
+	}{
+		{"gzip", GzipCompression, true},
+		{"none", NoCompression, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			crashed := &fakeClient{blocked: make(chan struct{})}
+			defer close(crashed.blocked)
+			logger := newTestLoggerWithCompression(t, dir, crashed, tc.compression)
+			for _, message := range messages {
+				logger.Log(time.Now(), message)
+			}
+			logger.file.Close() // crash
+
+			journal := readFile(t, filepath.Join(dir, journalName))
+			assert.Equal(t, tc.gzipped, strings.HasPrefix(journal, "\x1f\x8b"))
+			assert.Equal(t, !tc.gzipped, strings.Contains(journal, "compressible"))
+
+			// The journal is replayed whatever the Compression of the next
+			// Logger.
+			for _, compression := range []Compression{GzipCompression, NoCompression} {
+				assert.Equal(t, messages, journalMessages(t, dir))
+				crashed := &fakeClient{blocked: make(chan struct{})}
+				logger := newTestLoggerWithCompression(t, dir, crashed, compression)
+				logger.file.Close() // crash again, before the replay is written
+				close(crashed.blocked)
+			}
+
+			client := new(fakeClient)
+			logger = newTestLoggerWithCompression(t, dir, client, tc.compression)
+			logger.Close()
+			assert.Equal(t, messages, client.messages)
+			assert.Empty(t, readFile(t, filepath.Join(dir, journalName)))
+		})
+	}
+}
+
+func TestConfigWithoutPersistDir(t *testing.T) {
+	logger, err := New(&Config{
+		Config: cwlogger.Config{
+			Client:       new(fakeClient),
+			LogGroupName: "test",
+		},
+	})
+
+	assert.Nil(t, logger)
+	assert.EqualError(t, err, "cwloggerwal: config missing required PersistDir")
+}
@@ -0,0 +1,68 @@
+// Package cwloggerzap writes zap log entries to a cwlogger.Logger.
+//
+// # Usage
+//
+//	core := cwloggerzap.NewCore(
+//		logger,
+//		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+//		zapcore.InfoLevel,
+//	)
+//	log := zap.New(core)
+package cwloggerzap
+
+import (
+	"strings"
+
+	"github.com/jwoffindin/cwlogger"
+	"go.uber.org/zap/zapcore"
+)
+
+// NewCore returns a zapcore.Core that encodes each entry enabled by enab with
+// enc, and writes it to lg timestamped with the entry's time.
+func NewCore(lg *cwlogger.Logger, enc zapcore.Encoder, enab zapcore.LevelEnabler) zapcore.Core {
+	return &core{
+		LevelEnabler: enab,
+		enc:          enc,
+		logger:       lg,
+	}
+}
+
+type core struct {
+	zapcore.LevelEnabler
+	enc    zapcore.Encoder
+	logger *cwlogger.Logger
+}
+
+func (c *core) With(fields []zapcore.Field) zapcore.Core {
+	clone := &core{
+		LevelEnabler: c.LevelEnabler,
+		enc:          c.enc.Clone(),
+		logger:       c.logger,
+	}
+	for _, field := range fields {
+		field.AddTo(clone.enc)
+	}
+	return clone
+}
+
+func (c *core) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *core) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+	return c.logger.LogE(ent.Time, strings.TrimSuffix(buf.String(), "\n"))
+}
+
+// Sync writes the enqueued log messages like cwlogger.Logger.Flush.
+func (c *core) Sync() error {
+	c.logger.Flush()
+	return nil
+}
@@ -0,0 +1,88 @@
+package cwloggerzap
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/jwoffindin/cwlogger"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// fakeClient records the log events written to it.
+type fakeClient struct {
+	cwlogger.CloudWatchLogsAPI
+
+	mu     sync.Mutex
+	events []types.InputLogEvent
+}
+
+func (c *fakeClient) CreateLogGroup(ctx context.Context, params *cloudwatchlogs.CreateLogGroupInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogGroupOutput, error) {
+	return &cloudwatchlogs.CreateLogGroupOutput{}, nil
+}
+
+func (c *fakeClient) CreateLogStream(ctx context.Context, params *cloudwatchlogs.CreateLogStreamInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+	return &cloudwatchlogs.CreateLogStreamOutput{}, nil
+}
+
+func (c *fakeClient) PutLogEvents(ctx context.Context, params *cloudwatchlogs.PutLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutLogEventsOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, params.LogEvents...)
+	return &cloudwatchlogs.PutLogEventsOutput{}, nil
+}
+
+func TestCore(t *testing.T) {
+	client := new(fakeClient)
+	logger, err := cwlogger.New(&cwlogger.Config{
+		Client:       client,
+		LogGroupName: "test",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.EncodeTime = zapcore.RFC3339NanoTimeEncoder
+	now := time.Now().Add(-time.Minute).UTC()
+	log := zap.New(
+		NewCore(logger, zapcore.NewJSONEncoder(encoderConfig), zapcore.InfoLevel),
+		zap.WithClock(fixedClock{now}),
+	).With(zap.String("service", "api"))
+
+	log.Debug("ignored")
+	log.Info("hello", zap.Int("status", 200))
+	assert.NoError(t, log.Sync())
+	logger.Close()
+
+	if assert.Len(t, client.events, 1) {
+		event := client.events[0]
+		assert.JSONEq(t, `{
+			"level": "info",
+			"ts": "`+now.Format(time.RFC3339Nano)+`",
+			"msg": "hello",
+			"service": "api",
+			"status": 200
+		}`, aws.ToString(event.Message))
+		assert.Equal(t, now.UnixNano()/int64(time.Millisecond), aws.ToInt64(event.Timestamp))
+	}
+}
+
+// fixedClock is a zapcore.Clock that is stopped at a fixed time.
+type fixedClock struct {
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time {
+	return c.now
+}
+
+func (c fixedClock) NewTicker(d time.Duration) *time.Ticker {
+	return time.NewTicker(d)
+}
@@ -0,0 +1,40 @@
+package cwlogger
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// An Encoder encodes the fields of a structured log event, as logged by
+// LogWithFields and LogCtxFields, into its log message. The fields include the
+// "message" and "timestamp".
+type Encoder interface {
+	Encode(fields map[string]interface{}) (string, error)
+}
+
+// jsonEncoder is the default Encoder, encoding the fields as a JSON object
+// with json.Marshal.
+type jsonEncoder struct{}
+
+func (jsonEncoder) Encode(fields map[string]interface{}) (string, error) {
+	b, err := json.Marshal(fields)
+	return string(b), err
+}
+
+// NDJSONEncoder is an Encoder for consumers of newline-delimited JSON. It
+// encodes the fields as a JSON object on a single line, with the keys sorted,
+// and without escaping the HTML characters <, >, and & as json.Marshal does.
+// Newlines in the fields are always escaped, so a log message never spans more
+// than one line.
+type NDJSONEncoder struct{}
+
+func (NDJSONEncoder) Encode(fields map[string]interface{}) (string, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(fields); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
@@ -0,0 +1,50 @@
+package cwlogger
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// indented marshals itself as indented JSON, spanning several lines.
+type indented struct{}
+
+func (indented) MarshalJSON() ([]byte, error) {
+	return []byte("{\n  \"nested\": true\n}"), nil
+}
+
+func TestNDJSONEncoder(t *testing.T) {
+	s, err := NDJSONEncoder{}.Encode(map[string]interface{}{
+		"message": "first line\nsecond line\r\n",
+		"html":    "<b>&</b>",
+		"object":  indented{},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, `{"html":"<b>&</b>","message":"first line\nsecond line\r\n","object":{"nested":true}}`, s)
+	assert.NotContains(t, s, "\n")
+	assert.True(t, json.Valid([]byte(s)))
+}
+
+func TestLogWithFieldsEncoder(t *testing.T) {
+	client := new(mockClient)
+	logger, err := New(&Config{
+		Client:       client,
+		LogGroupName: "test",
+		Encoder:      NDJSONEncoder{},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	assert.NoError(t, logger.LogWithFields(now, "multi\nline", map[string]interface{}{"query": "a < b"}))
+	logger.Close()
+
+	expected := `{"message":"multi\nline","query":"a < b","timestamp":"` + now.Format(time.RFC3339Nano) + `"}`
+	assert.Equal(t, []string{expected}, client.messages[logger.StreamNames()[0]])
+}
@@ -1,12 +1,25 @@
 package cwlogger
 
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/smithy-go"
+)
+
 const (
-	errCodeDataAlreadyAcceptedException  = "DataAlreadyAcceptedException"
 	errCodeInvalidSequenceTokenException = "InvalidSequenceTokenException"
+	errCodeOperationAbortedException     = "OperationAbortedException"
+	errCodeResourceNotFoundException     = "ResourceNotFoundException"
 	errCodeThrottlingException           = "ThrottlingException"
 	errCodeInternalFailure               = "InternalFailure"
 	errCodeServiceUnavailable            = "ServiceUnavailable"
 	errCodeServiceUnavailableException   = "ServiceUnavailableException"
+	errCodeUnrecognizedClientException   = "UnrecognizedClientException"
+	errCodeExpiredTokenException         = "ExpiredTokenException"
+	errCodeExpiredToken                  = "ExpiredToken"
 )
 
 var retryableErrorCodes = map[string]struct{}{
@@ -17,9 +30,196 @@ var retryableErrorCodes = map[string]struct{}{
 	errCodeServiceUnavailableException:   {},
 }
 
+// ErrMessageTooLarge is returned by LogE, and reported to the ErrorReporter by
+// Log, when a log message exceeds the maximum log event size.
+var ErrMessageTooLarge = errors.New("cwlogger: log message too large")
+
+// ErrEmptyMessage is returned by LogE, and reported to the ErrorReporter by
+// Log, when a log message is empty or only whitespace, unless
+// AllowEmptyMessages is set.
+var ErrEmptyMessage = errors.New("cwlogger: log message empty")
+
+// ErrEventTooOld is returned by LogE, and reported to the ErrorReporter by Log,
+// when a log message is older than 14 days or the log group's retention
+// period.
+var ErrEventTooOld = errors.New("cwlogger: log event too old")
+
+// ErrEventTooNew is returned by LogE, and reported to the ErrorReporter by Log,
+// when a log message is timestamped further in the future than the configured
+// MaxFutureSkew.
+var ErrEventTooNew = errors.New("cwlogger: log event too far in the future")
+
+// ErrDropped is returned by LogE, and reported to the ErrorReporter, when a log
+// message is dropped because the queue of log messages is full.
+var ErrDropped = errors.New("cwlogger: log message dropped because the queue is full")
+
+// ErrRateLimited is returned by LogE when a log message is dropped because
+// more than MaxEventsPerSecond log messages are being logged. Log reports it to
+// the ErrorReporter at most once a second.
+var ErrRateLimited = errors.New("cwlogger: log message dropped because of the rate limit")
+
+// ErrCircuitOpen is wrapped by the error reported to the ErrorReporter when the
+// CircuitBreaker opens, and delivered to LogSync for log messages dropped
+// while it is open.
+var ErrCircuitOpen = errors.New("cwlogger: circuit breaker open")
+
+// ErrUnavailable is delivered to LogSync for log messages written to the
+// FallbackWriter because the Logger hasn't yet connected to CloudWatch Logs.
+var ErrUnavailable = errors.New("cwlogger: CloudWatch Logs unavailable")
+
+// ErrInvalidRetention is returned by New when the configured Retention is not
+// one of the values accepted by CloudWatch Logs.
+var ErrInvalidRetention = errors.New("cwlogger: invalid log group retention")
+
+// ErrInvalidLogClass is returned by New when the configured LogClass is not
+// one of the log classes offered by CloudWatch Logs.
+var ErrInvalidLogClass = errors.New("cwlogger: invalid log group class")
+
+// ErrTooManyStreams is reported to the ErrorReporter by LogToStream for log
+// messages to a new log stream once MaxPinnedStreams log streams are in use.
+var ErrTooManyStreams = errors.New("cwlogger: too many log streams")
+
+// ErrClosed is returned by LogE, and reported to the ErrorReporter by Log, when
+// logging to a Logger that has been closed.
+var ErrClosed = errors.New("cwlogger: logger is closed")
+
+// Reasons for log events to be rejected by a PutLogEvents call, as reported in
+// a RejectedLogEventsError.
+const (
+	RejectedTooNew  = "too new"
+	RejectedTooOld  = "too old"
+	RejectedExpired = "expired"
+)
+
+// RejectedLogEventsError is reported to the ErrorReporter when a PutLogEvents
+// call succeeds, but CloudWatch Logs rejects some of the log events in the
+// batch. Those log events are lost, and LogSync returns the error for them.
+type RejectedLogEventsError struct {
+	Reason string
+	Count  int
+}
+
+func (err *RejectedLogEventsError) Error() string {
+	return fmt.Sprintf("cwlogger: %d log events rejected as %s", err.Count, err.Reason)
+}
+
+// DroppedBatchError is reported to the ErrorReporter when a batch of log
+// events is dropped because writing it failed and it can't be retried, or has
+// run out of retries. It carries the dropped log events, so they can be routed
+// elsewhere, and unwraps to the error that caused them to be dropped.
+type DroppedBatchError struct {
+	Err       error
+	LogEvents []types.InputLogEvent
+}
+
+func (err *DroppedBatchError) Error() string {
+	return fmt.Sprintf("cwlogger: dropped %d log events: %v", len(err.LogEvents), err.Err)
+}
+
+func (err *DroppedBatchError) Unwrap() error {
+	return err.Err
+}
+
+// An ErrorPhase is the phase of writing logs in which an error occurred.
+type ErrorPhase string
+
+const (
+	// PhaseCreate is for errors creating or verifying the log group or a log
+	// stream.
+	PhaseCreate ErrorPhase = "create"
+
+	// PhaseEnqueue is for log messages rejected or dropped before being
+	// batched.
+	PhaseEnqueue ErrorPhase = "enqueue"
+
+	// PhaseWrite is for errors writing a batch that don't cause it to be
+	// retried or dropped, such as log events rejected by CloudWatch Logs.
+	PhaseWrite ErrorPhase = "write"
+
+	// PhaseRetry is for failed attempts to write a batch that is retried.
+	PhaseRetry ErrorPhase = "retry"
+
+	// PhaseDrop is for batches dropped because writing them failed, reported
+	// as a *DroppedBatchError.
+	PhaseDrop ErrorPhase = "drop"
+
+	// PhaseDelete is for errors deleting empty log streams on Close, when
+	// CleanupEmptyStreams is set.
+	PhaseDelete ErrorPhase = "delete"
+)
+
+// An ErrorEvent describes an error reported to OnError.
+type ErrorEvent struct {
+	Phase ErrorPhase
+
+	// The name of the log stream involved, or "" if none is.
+	Stream string
+
+	// The number of log events affected, or 0 if none are.
+	Events int
+
+	Err error
+}
+
+// errorHandler returns a function passing ErrorEvents to onError, and their
+// errors to errorReporter, except for retried batches, either being nil if
+// not configured.
+func errorHandler(onError func(ev ErrorEvent), errorReporter func(err error)) func(ev ErrorEvent) {
+	return func(ev ErrorEvent) {
+		if onError != nil {
+			onError(ev)
+		}
+		if errorReporter != nil && ev.Phase != PhaseRetry {
+			errorReporter(ev.Err)
+		}
+	}
+}
+
+// An errorCollector collects the errors of batches that failed to be written
+// or were dropped, for each FlushAsync waiting for the backlog to be written.
+// It is safe for concurrent use.
+type errorCollector struct {
+	mu   sync.Mutex
+	sets map[*[]error]struct{}
+}
+
+// start starts collecting errors, until stop is called with the returned set.
+func (c *errorCollector) start() *[]error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sets == nil {
+		c.sets = make(map[*[]error]struct{})
+	}
+	errs := new([]error)
+	c.sets[errs] = struct{}{}
+	return errs
+}
+
+// stop stops collecting errors into errs, returning those collected joined
+// together, or nil if there were none.
+func (c *errorCollector) stop(errs *[]error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.sets, errs)
+	return errors.Join(*errs...)
+}
+
+// add collects the error of an ErrorEvent reporting a failed write or a
+// dropped batch.
+func (c *errorCollector) add(ev ErrorEvent) {
+	if ev.Phase != PhaseWrite && ev.Phase != PhaseDrop {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for errs := range c.sets {
+		*errs = append(*errs, ev.Err)
+	}
+}
+
 // Error contains the AWS error code and message that caused the PutLogEvents
 // action to fail. Errors reported by the LogGroup ErrorReporter function may
-// be converted into this type.
+// be converted into this type with errors.As.
 type Error struct {
 	Code    string
 	Message string
@@ -32,6 +232,19 @@ func (err Error) Error() string {
 	return err.Code + ": " + err.Message
 }
 
+// toError converts an AWS API error into an Error. Other errors, such as
+// connection failures, are returned unchanged.
+func toError(err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return Error{
+			Code:    apiErr.ErrorCode(),
+			Message: apiErr.ErrorMessage(),
+		}
+	}
+	return err
+}
+
 func shouldRetry(err error) bool {
 	if ownErr, ok := err.(Error); ok {
 		_, found := retryableErrorCodes[ownErr.Code]
@@ -40,6 +253,14 @@ func shouldRetry(err error) bool {
 	return true
 }
 
+// isCredentialsError reports whether err is an authentication failure, which
+// CloudWatch Logs returns once temporary credentials have expired.
+func isCredentialsError(err error) bool {
+	return isErrorCode(err, errCodeUnrecognizedClientException) ||
+		isErrorCode(err, errCodeExpiredTokenException) ||
+		isErrorCode(err, errCodeExpiredToken)
+}
+
 func isErrorCode(err error, code string) bool {
 	if ownErr, ok := err.(Error); ok {
 		return ownErr.Code == code
@@ -47,4 +268,6 @@ func isErrorCode(err error, code string) bool {
 	return false
 }
 
-func noopErrorReporter(error) {}
+func noopSuccessReporter(int, int) {}
+
+func noopDebugLogger(string, ...interface{}) {}
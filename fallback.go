@@ -0,0 +1,78 @@
+package cwlogger
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// A syncWriter serializes writes to an io.Writer, as log events are written to
+// the FallbackWriter from several goroutines.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func newSyncWriter(w io.Writer) io.Writer {
+	if sw, ok := w.(*syncWriter); ok {
+		return sw
+	}
+	return &syncWriter{w: w}
+}
+
+func (sw *syncWriter) Write(p []byte) (int, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.w.Write(p)
+}
+
+// writeFallback writes the log events to the FallbackWriter, if set, one line
+// per log event.
+func (lg *Logger) writeFallback(logEvents []types.InputLogEvent) {
+	if lg.fallback == nil || len(logEvents) == 0 {
+		return
+	}
+	var b strings.Builder
+	for _, logEvent := range logEvents {
+		b.WriteString(time.UnixMilli(*logEvent.Timestamp).UTC().Format(time.RFC3339Nano))
+		b.WriteByte(' ')
+		b.WriteString(*logEvent.Message)
+		b.WriteByte('\n')
+	}
+	if _, err := io.WriteString(lg.fallback, b.String()); err != nil {
+		lg.debugLogger("cwlogger: unable to write to FallbackWriter: %v", err)
+	}
+}
+
+// reconnect retries initializing the log group and log streams with backoff
+// after New failed to, until it succeeds or ctx is cancelled when the Logger is
+// closed, closing lg.connecting when it returns. Until then, log events are
+// written to the FallbackWriter.
+func (lg *Logger) reconnect(ctx context.Context, config Config) {
+	defer close(lg.connecting)
+	streams := lg.initialStreams(&config)
+	for attempts := 1; ; attempts++ {
+		timer := time.NewTimer(retryDelay(attempts))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+		err := lg.initLogGroup(ctx, &config)
+		for err == nil && lg.StreamCount() < streams {
+			reply := make(chan error)
+			lg.streams.adds <- reply
+			err = <-reply
+		}
+		if err == nil {
+			lg.debugLogger("cwlogger: connected to CloudWatch Logs after %d attempts", attempts+1)
+			return
+		}
+		lg.debugLogger("cwlogger: unable to connect to CloudWatch Logs: %v", err)
+	}
+}
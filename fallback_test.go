@@ -0,0 +1,89 @@
+package cwlogger
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// unavailableClient is a mockClient whose CreateLogGroup calls fail while
+// unavailable is set.
+type unavailableClient struct {
+	*mockClient
+	unavailable bool
+}
+
+func (c *unavailableClient) CreateLogGroup(ctx context.Context, params *cloudwatchlogs.CreateLogGroupInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogGroupOutput, error) {
+	c.mu.Lock()
+	unavailable := c.unavailable
+	c.mu.Unlock()
+	if unavailable {
+		return nil, &types.ServiceUnavailableException{}
+	}
+	return c.mockClient.CreateLogGroup(ctx, params, optFns...)
+}
+
+func TestFallbackWriter(t *testing.T) {
+	withoutJitter(t, time.Millisecond)
+	client := &unavailableClient{mockClient: new(mockClient), unavailable: true}
+	var fallback bytes.Buffer
+	var reported []error
+	logger, err := New(&Config{
+		Client:         client,
+		LogGroupName:   "test",
+		FallbackWriter: &fallback,
+		ErrorReporter:  func(err error) { reported = append(reported, err) },
+		FlushInterval:  time.Millisecond,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer logger.Close()
+
+	if assert.Len(t, reported, 1) {
+		assert.ErrorAs(t, reported[0], new(*types.ServiceUnavailableException))
+	}
+	assert.Equal(t, 0, logger.StreamCount())
+
+	ts := time.Now().Truncate(time.Millisecond)
+	assert.ErrorIs(t, logger.LogSync(context.Background(), ts, "hello"), ErrUnavailable)
+	assert.Equal(t, ts.UTC().Format(time.RFC3339Nano)+" hello\n", fallback.String())
+	assert.NotContains(t, client.calls, "PutLogEvents")
+}
+
+func TestFallbackWriterReconnects(t *testing.T) {
+	withoutJitter(t, time.Millisecond)
+	client := &unavailableClient{mockClient: new(mockClient), unavailable: true}
+	var fallback bytes.Buffer
+	logger, err := New(&Config{
+		Client:         client,
+		LogGroupName:   "test",
+		FallbackWriter: &fallback,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer logger.Close()
+
+	logger.Log(time.Now(), "before")
+	logger.Flush()
+	assert.True(t, strings.HasSuffix(fallback.String(), " before\n"))
+
+	client.mu.Lock()
+	client.unavailable = false
+	client.mu.Unlock()
+	assert.Eventually(t, func() bool { return logger.StreamCount() == 1 }, time.Second, time.Millisecond)
+
+	logger.Log(time.Now(), "after")
+	logger.Flush()
+	assert.NotContains(t, fallback.String(), "after")
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	assert.Equal(t, []string{"after"}, client.messages[logger.StreamNames()[0]])
+}
@@ -0,0 +1,48 @@
+package cwlogger
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Hook is a logrus.Hook that writes log entries to a Logger.
+//
+//	logrus.AddHook(cwlogger.NewHook(logger, nil))
+type Hook struct {
+	logger *Logger
+	levels []logrus.Level
+}
+
+// NewHook creates a Hook that writes entries with the given levels to lg. If
+// levels is nil, entries of all levels are written.
+func NewHook(lg *Logger, levels []logrus.Level) *Hook {
+	if levels == nil {
+		levels = logrus.AllLevels
+	}
+	return &Hook{
+		logger: lg,
+		levels: levels,
+	}
+}
+
+// Levels returns the levels of the entries written by the hook.
+func (h *Hook) Levels() []logrus.Level {
+	return h.levels
+}
+
+// Fire formats the entry and enqueues it with the entry's time. The entry is
+// formatted with its logger's formatter, or a logrus.TextFormatter if it has
+// none.
+func (h *Hook) Fire(entry *logrus.Entry) error {
+	var formatter logrus.Formatter = &logrus.TextFormatter{DisableColors: true}
+	if entry.Logger != nil && entry.Logger.Formatter != nil {
+		formatter = entry.Logger.Formatter
+	}
+
+	b, err := formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	return h.logger.LogE(entry.Time, strings.TrimSuffix(string(b), "\n"))
+}
@@ -0,0 +1,70 @@
+package cwlogger
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHook(t *testing.T) {
+	var events []*InputLogEvent
+
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			var data PutLogEvents
+			parseBody(r, &data)
+			events = append(events, data.LogEvents...)
+			w.Write([]byte(`{"nextSequenceToken":"1"}`))
+		}
+	})
+
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	l.Formatter = &logrus.JSONFormatter{}
+	l.AddHook(NewHook(logger, nil))
+
+	now := time.Unix(time.Now().Unix(), 0)
+	l.WithTime(now).WithField("user", "alice").Info("first")
+	l.WithTime(now.Add(time.Second)).Warn("second")
+	logger.Close()
+
+	if assert.Len(t, events, 2) {
+		assert.EqualValues(t, now.Unix()*1000, events[0].Timestamp)
+		assert.Contains(t, events[0].Message, `"msg":"first"`)
+		assert.Contains(t, events[0].Message, `"user":"alice"`)
+		assert.EqualValues(t, now.Unix()*1000+1000, events[1].Timestamp)
+		assert.Contains(t, events[1].Message, `"level":"warning"`)
+		assert.NotContains(t, events[1].Message, "\n")
+	}
+}
+
+func TestHookLevels(t *testing.T) {
+	var messages []string
+
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			var data PutLogEvents
+			parseBody(r, &data)
+			for _, event := range data.LogEvents {
+				messages = append(messages, event.Message)
+			}
+			w.Write([]byte(`{"nextSequenceToken":"1"}`))
+		}
+	})
+
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	l.AddHook(NewHook(logger, []logrus.Level{logrus.ErrorLevel}))
+
+	l.Info("ignored")
+	l.Error("failed")
+	logger.Close()
+
+	if assert.Len(t, messages, 1) {
+		assert.Contains(t, messages[0], "msg=failed")
+	}
+}
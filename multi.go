@@ -0,0 +1,79 @@
+package cwlogger
+
+import (
+	"errors"
+	"time"
+)
+
+// A MultiLogger mirrors log messages to several Loggers, for example to write
+// them to both an application's own log group and a central one.
+type MultiLogger struct {
+	loggers []*Logger
+}
+
+// NewMulti creates a MultiLogger that writes each log message to all of the
+// given Loggers.
+func NewMulti(loggers ...*Logger) *MultiLogger {
+	return &MultiLogger{loggers: loggers}
+}
+
+// Log enqueues the log message with each of the Loggers like Logger.Log. Errors
+// are reported to the ErrorReporter of the Logger they occurred in.
+//
+// This method is safe for concurrent access by multiple goroutines.
+func (ml *MultiLogger) Log(t time.Time, s string) {
+	for _, lg := range ml.loggers {
+		lg.Log(t, s)
+	}
+}
+
+// LogE enqueues the log message with each of the Loggers like Logger.LogE,
+// returning the errors returned by any of them joined with errors.Join. A
+// log message rejected by one Logger is still enqueued with the others.
+//
+// This method is safe for concurrent access by multiple goroutines.
+func (ml *MultiLogger) LogE(t time.Time, s string) error {
+	var errs []error
+	for _, lg := range ml.loggers {
+		if err := lg.LogE(t, s); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Flush writes the log messages enqueued with each of the Loggers like
+// Logger.Flush.
+func (ml *MultiLogger) Flush() {
+	for _, lg := range ml.loggers {
+		lg.Flush()
+	}
+}
+
+// Close closes each of the Loggers like Logger.Close.
+func (ml *MultiLogger) Close() {
+	for _, lg := range ml.loggers {
+		lg.Close()
+	}
+}
+
+// Stats returns the sum of the Loggers' counters.
+//
+// This method is safe for concurrent access by multiple goroutines.
+func (ml *MultiLogger) Stats() Stats {
+	var total Stats
+	for _, lg := range ml.loggers {
+		s := lg.Stats()
+		total.EventsAccepted += s.EventsAccepted
+		total.EventsDropped += s.EventsDropped
+		total.BatchesSent += s.BatchesSent
+		total.BatchesRetried += s.BatchesRetried
+		total.BytesSent += s.BytesSent
+		total.CurrentStreams += s.CurrentStreams
+		total.QueuedEvents += s.QueuedEvents
+		total.InvalidTokenRecoveries += s.InvalidTokenRecoveries
+		total.DuplicateBatches += s.DuplicateBatches
+		total.StreamsQuarantined += s.StreamsQuarantined
+	}
+	return total
+}
@@ -0,0 +1,57 @@
+package cwlogger
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiLogger(t *testing.T) {
+	app, central := new(mockClient), new(mockClient)
+	appLogger, err := New(&Config{Client: app, LogGroupName: "app"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	centralLogger, err := New(&Config{Client: central, LogGroupName: "central"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ml := NewMulti(appLogger, centralLogger)
+	ml.Log(time.Now(), "first")
+	assert.NoError(t, ml.LogE(time.Now(), "second"))
+	ml.Close()
+
+	assert.Equal(t, map[string][]string{
+		appLogger.StreamNames()[0]: {"first", "second"},
+	}, app.messages)
+	assert.Equal(t, map[string][]string{
+		centralLogger.StreamNames()[0]: {"first", "second"},
+	}, central.messages)
+
+	stats := ml.Stats()
+	assert.EqualValues(t, 4, stats.EventsAccepted)
+	assert.EqualValues(t, 2, stats.BatchesSent)
+	assert.EqualValues(t, 2*(eventSize("first")+eventSize("second")), stats.BytesSent)
+}
+
+func TestMultiLoggerJoinsErrors(t *testing.T) {
+	first, err := New(&Config{Client: new(mockClient), LogGroupName: "first"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	second, err := New(&Config{Client: new(mockClient), LogGroupName: "second"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	first.Close()
+
+	ml := NewMulti(first, second)
+	err = ml.LogE(time.Now(), "message")
+	ml.Close()
+
+	assert.True(t, errors.Is(err, ErrClosed))
+	assert.EqualValues(t, 1, second.Stats().EventsAccepted)
+}
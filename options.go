@@ -0,0 +1,289 @@
+package cwlogger
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// An Option configures a Logger by modifying its Config, as an alternative to
+// populating a Config for New. Each With function returns an Option setting
+// the Config field of the same name.
+type Option func(config *Config)
+
+// NewFromAWSConfig creates a new Logger like NewWithContext, for the log group
+// named logGroup, writing with a CloudWatch Logs client created from cfg. The
+// rest of the Config is left at its defaults unless modified by opts.
+func NewFromAWSConfig(ctx context.Context, cfg aws.Config, logGroup string, opts ...Option) (*Logger, error) {
+	config := &Config{
+		Client:       cloudwatchlogs.NewFromConfig(cfg),
+		LogGroupName: logGroup,
+	}
+	for _, opt := range opts {
+		opt(config)
+	}
+	return NewWithContext(ctx, config)
+}
+
+// NewWithOptions creates a new Logger like New, for the log group named
+// logGroup, writing with client. The rest of the Config is left at its
+// defaults unless modified by opts.
+func NewWithOptions(client CloudWatchLogsAPI, logGroup string, opts ...Option) (*Logger, error) {
+	config := &Config{
+		Client:       client,
+		LogGroupName: logGroup,
+	}
+	for _, opt := range opts {
+		opt(config)
+	}
+	return New(config)
+}
+
+// WithErrorReporter sets the Config's ErrorReporter.
+func WithErrorReporter(fn func(err error)) Option {
+	return func(config *Config) { config.ErrorReporter = fn }
+}
+
+// WithOnError sets the Config's OnError.
+func WithOnError(fn func(ev ErrorEvent)) Option {
+	return func(config *Config) { config.OnError = fn }
+}
+
+// WithSuccessReporter sets the Config's SuccessReporter.
+func WithSuccessReporter(fn func(events int, bytes int)) Option {
+	return func(config *Config) { config.SuccessReporter = fn }
+}
+
+// WithDebugLogger sets the Config's DebugLogger.
+func WithDebugLogger(fn func(format string, v ...interface{})) Option {
+	return func(config *Config) { config.DebugLogger = fn }
+}
+
+// WithRetention sets the Config's Retention, in days.
+func WithRetention(days int) Option {
+	return func(config *Config) { config.Retention = days }
+}
+
+// WithEnforceRetention sets the Config's EnforceRetention.
+func WithEnforceRetention() Option {
+	return func(config *Config) { config.EnforceRetention = true }
+}
+
+// WithFlushInterval sets the Config's FlushInterval.
+func WithFlushInterval(d time.Duration) Option {
+	return func(config *Config) { config.FlushInterval = d }
+}
+
+// WithLogStreamName sets the Config's LogStreamName.
+func WithLogStreamName(name string) Option {
+	return func(config *Config) { config.LogStreamName = name }
+}
+
+// WithStreams sets the Config's Streams.
+func WithStreams(n int) Option {
+	return func(config *Config) { config.Streams = n }
+}
+
+// WithMaxStreams sets the Config's MaxStreams.
+func WithMaxStreams(n int) Option {
+	return func(config *Config) { config.MaxStreams = n }
+}
+
+// WithMaxPinnedStreams sets the Config's MaxPinnedStreams.
+func WithMaxPinnedStreams(n int) Option {
+	return func(config *Config) { config.MaxPinnedStreams = n }
+}
+
+// WithMaxQueueSize sets the Config's MaxQueueSize.
+func WithMaxQueueSize(n int) Option {
+	return func(config *Config) { config.MaxQueueSize = n }
+}
+
+// WithDropPolicy sets the Config's DropPolicy.
+func WithDropPolicy(policy DropPolicy) Option {
+	return func(config *Config) { config.DropPolicy = policy }
+}
+
+// WithMaxRetries sets the Config's MaxRetries.
+func WithMaxRetries(n int) Option {
+	return func(config *Config) { config.MaxRetries = n }
+}
+
+// WithRetryClassifier sets the Config's RetryClassifier.
+func WithRetryClassifier(fn func(err error) RetryDecision) Option {
+	return func(config *Config) { config.RetryClassifier = fn }
+}
+
+// WithKMSKeyID sets the Config's KMSKeyID.
+func WithKMSKeyID(id string) Option {
+	return func(config *Config) { config.KMSKeyID = id }
+}
+
+// WithTags sets the Config's Tags.
+func WithTags(tags map[string]string) Option {
+	return func(config *Config) { config.Tags = tags }
+}
+
+// WithDisableSequenceToken sets the Config's DisableSequenceToken.
+func WithDisableSequenceToken() Option {
+	return func(config *Config) { config.DisableSequenceToken = true }
+}
+
+// WithStreamNameFunc sets the Config's StreamNameFunc.
+func WithStreamNameFunc(fn func(index int) string) Option {
+	return func(config *Config) { config.StreamNameFunc = fn }
+}
+
+// WithStreamPrefixLength sets the Config's StreamPrefixLength.
+func WithStreamPrefixLength(n int) Option {
+	return func(config *Config) { config.StreamPrefixLength = n }
+}
+
+// WithStreamNameSuffixLength sets the Config's StreamNameSuffixLength.
+func WithStreamNameSuffixLength(n int) Option {
+	return func(config *Config) { config.StreamNameSuffixLength = n }
+}
+
+// WithClientOptions appends to the Config's ClientOptions.
+func WithClientOptions(optFns ...func(*cloudwatchlogs.Options)) Option {
+	return func(config *Config) { config.ClientOptions = append(config.ClientOptions, optFns...) }
+}
+
+// WithMaxClientAttempts sets the Config's MaxClientAttempts.
+func WithMaxClientAttempts(n int) Option {
+	return func(config *Config) { config.MaxClientAttempts = n }
+}
+
+// WithMaxFutureSkew sets the Config's MaxFutureSkew.
+func WithMaxFutureSkew(d time.Duration) Option {
+	return func(config *Config) { config.MaxFutureSkew = d }
+}
+
+// WithObserver sets the Config's Observer.
+func WithObserver(observer Observer) Option {
+	return func(config *Config) { config.Observer = observer }
+}
+
+// WithReuseRecentStream sets the Config's ReuseRecentStream.
+func WithReuseRecentStream() Option {
+	return func(config *Config) { config.ReuseRecentStream = true }
+}
+
+// WithRotateAfter sets the Config's RotateAfter.
+func WithRotateAfter(rotation Rotation) Option {
+	return func(config *Config) { config.RotateAfter = rotation }
+}
+
+// WithQuarantineAfter sets the Config's QuarantineAfter.
+func WithQuarantineAfter(n int) Option {
+	return func(config *Config) { config.QuarantineAfter = n }
+}
+
+// WithCleanupEmptyStreams sets the Config's CleanupEmptyStreams.
+func WithCleanupEmptyStreams() Option {
+	return func(config *Config) { config.CleanupEmptyStreams = true }
+}
+
+// WithDefaultFields sets the Config's DefaultFields.
+func WithDefaultFields(fields map[string]interface{}) Option {
+	return func(config *Config) { config.DefaultFields = fields }
+}
+
+// WithContextExtractor sets the Config's ContextExtractor.
+func WithContextExtractor(fn func(ctx context.Context) map[string]interface{}) Option {
+	return func(config *Config) { config.ContextExtractor = fn }
+}
+
+// WithIncludeSourceMetadata sets the Config's IncludeSourceMetadata.
+func WithIncludeSourceMetadata() Option {
+	return func(config *Config) { config.IncludeSourceMetadata = true }
+}
+
+// WithEncoder sets the Config's Encoder.
+func WithEncoder(enc Encoder) Option {
+	return func(config *Config) { config.Encoder = enc }
+}
+
+// WithCallTimeout sets the Config's CallTimeout.
+func WithCallTimeout(d time.Duration) Option {
+	return func(config *Config) { config.CallTimeout = d }
+}
+
+// WithLogClass sets the Config's LogClass.
+func WithLogClass(class LogClass) Option {
+	return func(config *Config) { config.LogClass = class }
+}
+
+// WithEntity sets the Config's Entity.
+func WithEntity(entity *types.Entity) Option {
+	return func(config *Config) { config.Entity = entity }
+}
+
+// WithAccountID sets the Config's AccountID.
+func WithAccountID(id string) Option {
+	return func(config *Config) { config.AccountID = id }
+}
+
+// WithAssumeLogGroupExists sets the Config's AssumeLogGroupExists.
+func WithAssumeLogGroupExists() Option {
+	return func(config *Config) { config.AssumeLogGroupExists = true }
+}
+
+// WithCheckLogGroup sets the Config's CheckLogGroup.
+func WithCheckLogGroup() Option {
+	return func(config *Config) { config.CheckLogGroup = true }
+}
+
+// WithDryRun sets the Config's DryRun.
+func WithDryRun() Option {
+	return func(config *Config) { config.DryRun = true }
+}
+
+// WithCoalesceDuplicates sets the Config's CoalesceDuplicates.
+func WithCoalesceDuplicates() Option {
+	return func(config *Config) { config.CoalesceDuplicates = true }
+}
+
+// WithMessageTransform sets the Config's MessageTransform.
+func WithMessageTransform(fn func(s string) string) Option {
+	return func(config *Config) { config.MessageTransform = fn }
+}
+
+// WithAllowEmptyMessages sets the Config's AllowEmptyMessages.
+func WithAllowEmptyMessages() Option {
+	return func(config *Config) { config.AllowEmptyMessages = true }
+}
+
+// WithOrderedSingleStream sets the Config's OrderedSingleStream.
+func WithOrderedSingleStream() Option {
+	return func(config *Config) { config.OrderedSingleStream = true }
+}
+
+// WithMaxBytesPerSecond sets the Config's MaxBytesPerSecond.
+func WithMaxBytesPerSecond(n int) Option {
+	return func(config *Config) { config.MaxBytesPerSecond = n }
+}
+
+// WithMaxEventsPerSecond sets the Config's MaxEventsPerSecond.
+func WithMaxEventsPerSecond(n int) Option {
+	return func(config *Config) { config.MaxEventsPerSecond = n }
+}
+
+// WithCircuitBreaker sets the Config's CircuitBreaker.
+func WithCircuitBreaker(breaker CircuitBreaker) Option {
+	return func(config *Config) { config.CircuitBreaker = breaker }
+}
+
+// WithFallbackWriter sets the Config's FallbackWriter.
+func WithFallbackWriter(w io.Writer) Option {
+	return func(config *Config) { config.FallbackWriter = w }
+}
+
+// WithOutageBufferSize sets the Config's OutageBufferSize.
+func WithOutageBufferSize(n int) Option {
+	return func(config *Config) { config.OutageBufferSize = n }
+}
@@ -0,0 +1,133 @@
+package cwlogger
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFromAWSConfig(t *testing.T) {
+	var calls []string
+	var messages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, action(r))
+		if action(r) == "PutLogEvents" {
+			var data PutLogEvents
+			parseBody(r, &data)
+			for _, event := range data.LogEvents {
+				messages = append(messages, event.Message)
+			}
+		}
+	}))
+	defer server.Close()
+
+	cfg := aws.Config{
+		Region:       "us-east-1",
+		Credentials:  StaticCredentials{},
+		BaseEndpoint: aws.String(server.URL),
+		Retryer:      func() aws.Retryer { return aws.NopRetryer{} },
+	}
+	logger, err := NewFromAWSConfig(context.Background(), cfg, "test", func(config *Config) {
+		config.Retention = 7
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	logger.Log(time.Now(), "first")
+	logger.Close()
+
+	assert.Equal(t, "test", logger.LogGroupName())
+	assert.Equal(t, []string{"CreateLogGroup", "PutRetentionPolicy", "CreateLogStream", "PutLogEvents"}, calls)
+	assert.Equal(t, []string{"first"}, messages)
+}
+
+func TestOptions(t *testing.T) {
+	tags := map[string]string{"team": "infra"}
+	fields := map[string]interface{}{"service": "api"}
+	observer := noopObserver{}
+
+	tests := []struct {
+		name   string
+		option Option
+		check  func(config *Config) bool
+	}{
+		{"ErrorReporter", WithErrorReporter(func(error) {}), func(c *Config) bool { return c.ErrorReporter != nil }},
+		{"OnError", WithOnError(func(ErrorEvent) {}), func(c *Config) bool { return c.OnError != nil }},
+		{"SuccessReporter", WithSuccessReporter(func(int, int) {}), func(c *Config) bool { return c.SuccessReporter != nil }},
+		{"DebugLogger", WithDebugLogger(func(string, ...interface{}) {}), func(c *Config) bool { return c.DebugLogger != nil }},
+		{"Retention", WithRetention(14), func(c *Config) bool { return c.Retention == 14 }},
+		{"EnforceRetention", WithEnforceRetention(), func(c *Config) bool { return c.EnforceRetention }},
+		{"FlushInterval", WithFlushInterval(time.Second), func(c *Config) bool { return c.FlushInterval == time.Second }},
+		{"LogStreamName", WithLogStreamName("stream"), func(c *Config) bool { return c.LogStreamName == "stream" }},
+		{"Streams", WithStreams(4), func(c *Config) bool { return c.Streams == 4 }},
+		{"MaxStreams", WithMaxStreams(8), func(c *Config) bool { return c.MaxStreams == 8 }},
+		{"MaxPinnedStreams", WithMaxPinnedStreams(8), func(c *Config) bool { return c.MaxPinnedStreams == 8 }},
+		{"MaxQueueSize", WithMaxQueueSize(100), func(c *Config) bool { return c.MaxQueueSize == 100 }},
+		{"DropPolicy", WithDropPolicy(DropOldest), func(c *Config) bool { return c.DropPolicy == DropOldest }},
+		{"MaxRetries", WithMaxRetries(3), func(c *Config) bool { return c.MaxRetries == 3 }},
+		{"RetryClassifier", WithRetryClassifier(DefaultRetryClassifier), func(c *Config) bool { return c.RetryClassifier != nil }},
+		{"KMSKeyID", WithKMSKeyID("key"), func(c *Config) bool { return c.KMSKeyID == "key" }},
+		{"Tags", WithTags(tags), func(c *Config) bool { return c.Tags["team"] == "infra" }},
+		{"DisableSequenceToken", WithDisableSequenceToken(), func(c *Config) bool { return c.DisableSequenceToken }},
+		{"StreamNameFunc", WithStreamNameFunc(func(int) string { return "" }), func(c *Config) bool { return c.StreamNameFunc != nil }},
+		{"StreamPrefixLength", WithStreamPrefixLength(16), func(c *Config) bool { return c.StreamPrefixLength == 16 }},
+		{"StreamNameSuffixLength", WithStreamNameSuffixLength(4), func(c *Config) bool { return c.StreamNameSuffixLength == 4 }},
+		{"ClientOptions", WithClientOptions(func(*cloudwatchlogs.Options) {}), func(c *Config) bool { return len(c.ClientOptions) == 1 }},
+		{"MaxClientAttempts", WithMaxClientAttempts(3), func(c *Config) bool { return c.MaxClientAttempts == 3 }},
+		{"MaxFutureSkew", WithMaxFutureSkew(time.Minute), func(c *Config) bool { return c.MaxFutureSkew == time.Minute }},
+		{"Observer", WithObserver(observer), func(c *Config) bool { return c.Observer == observer }},
+		{"ReuseRecentStream", WithReuseRecentStream(), func(c *Config) bool { return c.ReuseRecentStream }},
+		{"RotateAfter", WithRotateAfter(Rotation{Age: time.Hour}), func(c *Config) bool { return c.RotateAfter.Age == time.Hour }},
+		{"QuarantineAfter", WithQuarantineAfter(3), func(c *Config) bool { return c.QuarantineAfter == 3 }},
+		{"CleanupEmptyStreams", WithCleanupEmptyStreams(), func(c *Config) bool { return c.CleanupEmptyStreams }},
+		{"DefaultFields", WithDefaultFields(fields), func(c *Config) bool { return c.DefaultFields["service"] == "api" }},
+		{"ContextExtractor", WithContextExtractor(func(context.Context) map[string]interface{} { return nil }), func(c *Config) bool { return c.ContextExtractor != nil }},
+		{"IncludeSourceMetadata", WithIncludeSourceMetadata(), func(c *Config) bool { return c.IncludeSourceMetadata }},
+		{"Encoder", WithEncoder(NDJSONEncoder{}), func(c *Config) bool { return c.Encoder == NDJSONEncoder{} }},
+		{"CallTimeout", WithCallTimeout(time.Second), func(c *Config) bool { return c.CallTimeout == time.Second }},
+		{"LogClass", WithLogClass(LogClassInfrequentAccess), func(c *Config) bool { return c.LogClass == LogClassInfrequentAccess }},
+		{"Entity", WithEntity(&types.Entity{}), func(c *Config) bool { return c.Entity != nil }},
+		{"AccountID", WithAccountID("123456789012"), func(c *Config) bool { return c.AccountID == "123456789012" }},
+		{"AssumeLogGroupExists", WithAssumeLogGroupExists(), func(c *Config) bool { return c.AssumeLogGroupExists }},
+		{"CheckLogGroup", WithCheckLogGroup(), func(c *Config) bool { return c.CheckLogGroup }},
+		{"DryRun", WithDryRun(), func(c *Config) bool { return c.DryRun }},
+		{"CoalesceDuplicates", WithCoalesceDuplicates(), func(c *Config) bool { return c.CoalesceDuplicates }},
+		{"MessageTransform", WithMessageTransform(func(s string) string { return s }), func(c *Config) bool { return c.MessageTransform != nil }},
+		{"AllowEmptyMessages", WithAllowEmptyMessages(), func(c *Config) bool { return c.AllowEmptyMessages }},
+		{"OrderedSingleStream", WithOrderedSingleStream(), func(c *Config) bool { return c.OrderedSingleStream }},
+		{"MaxBytesPerSecond", WithMaxBytesPerSecond(1024), func(c *Config) bool { return c.MaxBytesPerSecond == 1024 }},
+		{"MaxEventsPerSecond", WithMaxEventsPerSecond(100), func(c *Config) bool { return c.MaxEventsPerSecond == 100 }},
+		{"CircuitBreaker", WithCircuitBreaker(CircuitBreaker{Failures: 5}), func(c *Config) bool { return c.CircuitBreaker.Failures == 5 }},
+		{"FallbackWriter", WithFallbackWriter(os.Stderr), func(c *Config) bool { return c.FallbackWriter == os.Stderr }},
+		{"OutageBufferSize", WithOutageBufferSize(10), func(c *Config) bool { return c.OutageBufferSize == 10 }},
+	}
+
+	for _, test := range tests {
+		config := new(Config)
+		test.option(config)
+		assert.True(t, test.check(config), test.name)
+	}
+}
+
+func TestNewWithOptions(t *testing.T) {
+	client := new(mockClient)
+	logger, err := NewWithOptions(client, "test", WithRetention(14), WithLogStreamName("stream"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	logger.Log(time.Now(), "first")
+	logger.Close()
+
+	assert.Equal(t, []string{"CreateLogGroup", "PutRetentionPolicy", "DescribeLogStreams", "CreateLogStream", "PutLogEvents"}, client.calls)
+	assert.Equal(t, map[string][]string{"stream": {"first"}}, client.messages)
+}
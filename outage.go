@@ -0,0 +1,100 @@
+package cwlogger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// An outage holds the batches that ran out of retries while CloudWatch Logs is
+// unavailable, replaying them once a log stream can be written to again.
+// Its methods are only called from the coordinator.
+type outage struct {
+	batches []*pendingBatch
+	active  bool
+}
+
+// hold holds a batch until CloudWatch Logs recovers, starting to check for
+// recovery in the background if not already. Once OutageBufferSize batches are
+// held, further batches are dropped.
+func (ls *logStreams) hold(batch *pendingBatch, err error) {
+	if len(ls.outage.batches) >= ls.logger.outageBuffer {
+		ls.drop(batch, "", err)
+		return
+	}
+	ls.outage.batches = append(ls.outage.batches, batch)
+	if !ls.outage.active {
+		ls.outage.active = true
+		ls.logger.onError(ErrorEvent{
+			Phase:  PhaseWrite,
+			Events: batch.events(),
+			Err:    fmt.Errorf("cwlogger: holding batches until CloudWatch Logs recovers: %w", err),
+		})
+		go ls.awaitRecovery()
+	}
+}
+
+// awaitRecovery checks with backoff whether the log group and a log stream are
+// available again, recreating them if they were deleted, then tells the
+// coordinator to replay the held batches. If the Logger is closed first, the
+// coordinator drops them instead.
+func (ls *logStreams) awaitRecovery() {
+	for attempts := 1; ; attempts++ {
+		timer := time.NewTimer(retryDelay(attempts))
+		select {
+		case <-timer.C:
+		case <-ls.closing:
+			timer.Stop()
+			ls.resumes <- false
+			return
+		}
+		if ls.revalidate() {
+			ls.resumes <- true
+			return
+		}
+	}
+}
+
+// revalidate checks that the first log stream exists, recreating it and the
+// log group if either was deleted, returning whether it can be written to.
+func (ls *logStreams) revalidate() bool {
+	ls.mu.RLock()
+	if len(ls.streams) == 0 {
+		ls.mu.RUnlock()
+		return false
+	}
+	stream := ls.streams[0]
+	ls.mu.RUnlock()
+
+	existing, err := stream.describe(context.Background())
+	var notFoundErr *types.ResourceNotFoundException
+	switch {
+	case err == nil && existing != nil:
+		return true
+	case err != nil && !errors.As(err, &notFoundErr):
+		ls.logger.debugLogger("cwlogger: CloudWatch Logs still unavailable: %v", err)
+		return false
+	}
+	return ls.recreate(stream)
+}
+
+// endOutage replays the held batches if CloudWatch Logs recovered, or drops
+// them otherwise.
+func (ls *logStreams) endOutage(recovered bool) {
+	batches := ls.outage.batches
+	ls.outage = outage{}
+	if !recovered {
+		for _, batch := range batches {
+			ls.drop(batch, "", ErrClosed)
+		}
+		return
+	}
+	ls.logger.debugLogger("cwlogger: CloudWatch Logs recovered, replaying %d batches", len(batches))
+	for _, batch := range batches {
+		batch.attempts = 0
+		go ls.resend(batch)
+	}
+}
@@ -0,0 +1,93 @@
+package cwlogger
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutageBuffer(t *testing.T) {
+	withoutJitter(t, time.Millisecond)
+	client := &failingClient{mockClient: new(mockClient), failing: true}
+	var mu sync.Mutex
+	var reported []error
+	logger, err := New(&Config{
+		Client:           client,
+		LogGroupName:     "test",
+		MaxRetries:       1,
+		OutageBufferSize: 10,
+		ErrorReporter: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			reported = append(reported, err)
+		},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// The first batch runs out of retries and is held, and later batches are
+	// held without being written.
+	logger.Log(time.Now(), "first")
+	logger.batcher.requestFlush()
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(reported) > 0
+	}, time.Second, time.Millisecond)
+	logger.Log(time.Now(), "second")
+
+	client.mu.Lock()
+	client.failing = false
+	client.mu.Unlock()
+	logger.Flush()
+	logger.Close()
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	assert.ElementsMatch(t, []string{"first", "second"}, client.messages[logger.StreamNames()[0]])
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, err := range reported {
+		var dropped *DroppedBatchError
+		assert.False(t, errors.As(err, &dropped), "unexpected dropped batch: %v", err)
+		assert.True(t, strings.HasPrefix(err.Error(), "cwlogger: holding batches"), err.Error())
+	}
+}
+
+func TestOutageBufferDroppedOnClose(t *testing.T) {
+	withoutJitter(t, time.Millisecond)
+	client := &failingClient{mockClient: new(mockClient), failing: true}
+	var mu sync.Mutex
+	var reported []error
+	logger, err := New(&Config{
+		Client:           client,
+		LogGroupName:     "test",
+		MaxRetries:       1,
+		OutageBufferSize: 10,
+		ErrorReporter: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			reported = append(reported, err)
+		},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	logger.Log(time.Now(), "lost")
+	logger.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	var dropped *DroppedBatchError
+	if assert.Len(t, reported, 2) && assert.ErrorAs(t, reported[1], &dropped) {
+		assert.ErrorIs(t, dropped, ErrClosed)
+		assert.Equal(t, "lost", *dropped.LogEvents[0].Message)
+	}
+}
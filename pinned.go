@@ -0,0 +1,167 @@
+package cwlogger
+
+import (
+	"sync"
+	"time"
+)
+
+// pinnedStreams holds a Logger for each log stream named with LogToStream,
+// created the first time the log stream is written to. Each writes to its log
+// stream alone, with its own batches and sequence token, but shares the rate
+// limits, circuit breaker, and counters of the parent Logger.
+type pinnedStreams struct {
+	parent *Logger
+	config Config // of the parent Logger
+	max    int
+
+	mu      sync.Mutex // guards loggers and closed
+	loggers map[string]*pinnedLogger
+	closed  bool
+}
+
+// A pinnedLogger is the Logger for a log stream named with LogToStream, which
+// is ready once the Logger has been created, or has failed to be. lg and err
+// are set before ready is closed.
+type pinnedLogger struct {
+	ready chan struct{}
+	lg    *Logger
+	err   error
+}
+
+const defaultMaxPinnedStreams = 100
+
+func newPinnedStreams(parent *Logger, config Config) *pinnedStreams {
+	max := defaultMaxPinnedStreams
+	if config.MaxPinnedStreams > 0 {
+		max = config.MaxPinnedStreams
+	}
+	return &pinnedStreams{
+		parent:  parent,
+		config:  config,
+		max:     max,
+		loggers: make(map[string]*pinnedLogger),
+	}
+}
+
+// logger returns the Logger for the named log stream, creating it and the log
+// stream if needed. Creating the log stream doesn't hold up log messages to
+// other log streams, but those to the same log stream wait for it.
+func (p *pinnedStreams) logger(name string) (*Logger, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrClosed
+	}
+	if pinned, ok := p.loggers[name]; ok {
+		p.mu.Unlock()
+		<-pinned.ready
+		return pinned.lg, pinned.err
+	}
+	if len(p.loggers) >= p.max {
+		p.mu.Unlock()
+		return nil, ErrTooManyStreams
+	}
+	pinned := &pinnedLogger{ready: make(chan struct{})}
+	p.loggers[name] = pinned
+	p.mu.Unlock()
+
+	// The parent Logger has already created or verified the log group.
+	config := p.config
+	config.LogStreamName = name
+	config.StreamNameSuffixLength = 0
+	config.AssumeLogGroupExists = true
+	config.EnforceRetention = false
+	config.AccountID = ""
+	lg, err := New(&config)
+	if err == nil {
+		lg.share(p.parent)
+	}
+
+	pinned.lg, pinned.err = lg, err
+	if err != nil {
+		// Let the next log message to the log stream try again.
+		p.mu.Lock()
+		delete(p.loggers, name)
+		p.mu.Unlock()
+	}
+	close(pinned.ready)
+	return lg, err
+}
+
+// share makes the Logger, before anything is logged to it, apply the rate
+// limits and circuit breaker of the parent Logger, and count its log events in
+// the parent's Stats and Pending, and its errors in the parent's FlushAsync.
+func (lg *Logger) share(parent *Logger) {
+	lg.limiter = parent.limiter
+	lg.eventLimiter = parent.eventLimiter
+	lg.breaker = parent.breaker
+	lg.stats = parent.stats
+	lg.pending = parent.pending
+	lg.flushErrors = parent.flushErrors
+}
+
+// all returns the Loggers created so far.
+func (p *pinnedStreams) all() []*Logger {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	loggers := make([]*Logger, 0, len(p.loggers))
+	for _, pinned := range p.loggers {
+		select {
+		case <-pinned.ready:
+			if pinned.lg != nil {
+				loggers = append(loggers, pinned.lg)
+			}
+		default:
+		}
+	}
+	return loggers
+}
+
+// close closes the Loggers, preventing any more from being created, and
+// waiting for those being created to close them too.
+func (p *pinnedStreams) close() {
+	p.mu.Lock()
+	p.closed = true
+	pending := make([]*pinnedLogger, 0, len(p.loggers))
+	for _, pinned := range p.loggers {
+		pending = append(pending, pinned)
+	}
+	p.mu.Unlock()
+	for _, pinned := range pending {
+		<-pinned.ready
+		if pinned.lg != nil {
+			pinned.lg.Close()
+		}
+	}
+}
+
+// LogToStream enqueues a log message like Log, to be written to the named log
+// stream instead of the Logger's own log streams, for example to keep each
+// tenant's log events in a log stream of their own. The log stream is created
+// the first time it is written to, if it doesn't already exist, and is written
+// to separately from the Logger's own log streams, with batches of its own.
+// Errors creating the log stream are reported to the ErrorReporter. At most
+// MaxPinnedStreams log streams are written to with LogToStream.
+//
+// Log events written with LogToStream are subject to the Logger's
+// MaxBytesPerSecond, MaxEventsPerSecond, and CircuitBreaker, and are counted
+// in its Stats and Pending, but their log streams aren't counted in
+// CurrentStreams or StreamCount.
+//
+// This method is safe for concurrent access by multiple goroutines.
+func (lg *Logger) LogToStream(streamName string, t time.Time, s string) {
+	pinned, err := lg.pinned.logger(streamName)
+	if err != nil {
+		lg.onError(ErrorEvent{Phase: PhaseCreate, Stream: streamName, Events: 1, Err: err})
+		return
+	}
+	pinned.Log(t, s)
+}
+
+// requestFlushPinned asks the Loggers of the log streams named with
+// LogToStream to send their batches, like requestFlush.
+func (lg *Logger) requestFlushPinned() {
+	for _, pinned := range lg.pinned.all() {
+		pinned.batcher.requestFlush()
+	}
+}
@@ -0,0 +1,122 @@
+package cwlogger
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// DropPolicy determines what Log does when the queue of log messages waiting
+// to be batched is full.
+type DropPolicy int
+
+const (
+	// Block waits until there is room in the queue.
+	Block DropPolicy = iota
+
+	// DropNewest drops the log message being logged.
+	DropNewest
+
+	// DropOldest drops the oldest log message in the queue to make room for
+	// the one being logged.
+	DropOldest
+)
+
+// enqueue adds the log event to the batcher's input queue, following the drop
+// policy if the queue is full, unless ctx is done first.
+func (lg *Logger) enqueue(ctx context.Context, logEvent logEvent) error {
+	if err := ctx.Err(); err != nil {
+		atomic.AddInt64(&lg.stats.eventsDropped, 1)
+		return err
+	}
+
+	lg.pending.add(1)
+
+	switch lg.dropPolicy {
+	case DropNewest:
+		select {
+		case lg.batcher.input <- logEvent:
+		default:
+			lg.pending.add(-1)
+			atomic.AddInt64(&lg.stats.eventsDropped, 1)
+			return ErrDropped
+		}
+	case DropOldest:
+		for sent := false; !sent; {
+			select {
+			case lg.batcher.input <- logEvent:
+				sent = true
+			default:
+				select {
+				case dropped := <-lg.batcher.input:
+					if dropped.done != nil {
+						dropped.done <- ErrDropped
+					}
+					lg.pending.add(-1)
+					atomic.AddInt64(&lg.stats.eventsDropped, 1)
+					lg.onError(ErrorEvent{Phase: PhaseEnqueue, Events: 1, Err: ErrDropped})
+				default:
+				}
+			}
+		}
+	default:
+		select {
+		case lg.batcher.input <- logEvent:
+		case <-ctx.Done():
+			lg.pending.add(-1)
+			atomic.AddInt64(&lg.stats.eventsDropped, 1)
+			return ctx.Err()
+		}
+	}
+
+	atomic.AddInt64(&lg.stats.eventsAccepted, 1)
+	lg.observer.LogEventsAccepted(1)
+	return nil
+}
+
+// pendingEvents counts the log events that have been accepted but not yet
+// written or dropped.
+type pendingEvents struct {
+	mu   sync.Mutex
+	n    int
+	idle chan struct{} // closed while n is zero
+}
+
+func newPendingEvents() *pendingEvents {
+	p := &pendingEvents{idle: make(chan struct{})}
+	close(p.idle)
+	return p
+}
+
+func (p *pendingEvents) add(delta int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.n == 0 && delta > 0 {
+		p.idle = make(chan struct{})
+	}
+	p.n += delta
+	if p.n == 0 && delta < 0 {
+		close(p.idle)
+	}
+}
+
+func (p *pendingEvents) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.n
+}
+
+// wait blocks until there are no pending log events, or ctx is done.
+func (p *pendingEvents) wait(ctx context.Context) error {
+	p.mu.Lock()
+	idle := p.idle
+	p.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,224 @@
+package cwlogger
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// blockedServer returns a handler that blocks PutLogEvents calls until release
+// is closed, and records the messages it receives.
+func blockedServer(release chan struct{}, mu *sync.Mutex, messages *[]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			<-release
+			var data PutLogEvents
+			parseBody(r, &data)
+			mu.Lock()
+			for _, event := range data.LogEvents {
+				*messages = append(*messages, event.Message)
+			}
+			mu.Unlock()
+			w.Write([]byte(`{"nextSequenceToken":"1"}`))
+		}
+	}
+}
+
+// fillQueue logs count messages, pausing between each so that the batcher
+// emits small batches and the pipeline backs up behind the blocked client.
+func fillQueue(logger *Logger, count int) {
+	for i := 0; i < count; i++ {
+		logger.Log(time.Now(), strconv.Itoa(i))
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDropNewest(t *testing.T) {
+	var mu sync.Mutex
+	var messages []string
+	var reported []error
+	release := make(chan struct{})
+	config := &Config{
+		LogGroupName:  "test",
+		FlushInterval: time.Millisecond,
+		MaxQueueSize:  5,
+		DropPolicy:    DropNewest,
+		ErrorReporter: func(err error) {
+			mu.Lock()
+			reported = append(reported, err)
+			mu.Unlock()
+		},
+	}
+
+	logger := newLoggerWithServer(config, blockedServer(release, &mu, &messages))
+	fillQueue(logger, 200)
+	close(release)
+	logger.Close()
+
+	stats := logger.Stats()
+	assert.True(t, stats.EventsDropped > 0, "expected events to be dropped")
+	assert.EqualValues(t, 200, stats.EventsAccepted+stats.EventsDropped)
+	assert.Len(t, messages, int(stats.EventsAccepted))
+	assert.Len(t, reported, int(stats.EventsDropped))
+	for _, err := range reported {
+		assert.Equal(t, ErrDropped, err)
+	}
+	assert.Equal(t, "0", messages[0])
+	assert.NotContains(t, messages, "199")
+}
+
+func TestDropOldest(t *testing.T) {
+	var mu sync.Mutex
+	var messages []string
+	var reported []error
+	release := make(chan struct{})
+	config := &Config{
+		LogGroupName:  "test",
+		FlushInterval: time.Millisecond,
+		MaxQueueSize:  5,
+		DropPolicy:    DropOldest,
+		ErrorReporter: func(err error) {
+			mu.Lock()
+			reported = append(reported, err)
+			mu.Unlock()
+		},
+	}
+
+	logger := newLoggerWithServer(config, blockedServer(release, &mu, &messages))
+	fillQueue(logger, 200)
+	close(release)
+	logger.Close()
+
+	stats := logger.Stats()
+	assert.True(t, stats.EventsDropped > 0, "expected events to be dropped")
+	assert.EqualValues(t, 200, stats.EventsAccepted)
+	assert.Len(t, messages, int(200-stats.EventsDropped))
+	assert.Len(t, reported, int(stats.EventsDropped))
+	assert.Contains(t, messages, "199")
+}
+
+func TestBlockPolicy(t *testing.T) {
+	var mu sync.Mutex
+	var messages []string
+	release := make(chan struct{})
+	config := &Config{
+		LogGroupName:  "test",
+		FlushInterval: time.Millisecond,
+		MaxQueueSize:  5,
+	}
+
+	logger := newLoggerWithServer(config, blockedServer(release, &mu, &messages))
+
+	logged := make(chan struct{})
+	go func() {
+		fillQueue(logger, 200)
+		close(logged)
+	}()
+
+	select {
+	case <-logged:
+		assert.Fail(t, "Log did not block while the queue was full")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	close(release)
+	<-logged
+	logger.Close()
+
+	assert.Len(t, messages, 200)
+	assert.EqualValues(t, 0, logger.Stats().EventsDropped)
+}
+
+func TestPending(t *testing.T) {
+	var mu sync.Mutex
+	var messages []string
+	release := make(chan struct{})
+	config := &Config{
+		LogGroupName:  "test",
+		FlushInterval: time.Millisecond,
+	}
+
+	logger := newLoggerWithServer(config, blockedServer(release, &mu, &messages))
+	assert.Equal(t, 0, logger.Pending())
+
+	fillQueue(logger, 10)
+	assert.Equal(t, 10, logger.Pending())
+
+	close(release)
+	logger.Flush()
+	assert.Equal(t, 0, logger.Pending())
+	logger.Close()
+}
+
+func TestLogCtxCancelled(t *testing.T) {
+	var calls int
+	var reported []error
+	config := &Config{
+		LogGroupName: "test",
+		ErrorReporter: func(err error) {
+			reported = append(reported, err)
+		},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			calls++
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	logger.LogCtx(ctx, time.Now(), "message")
+	logger.Close()
+
+	assert.Equal(t, 0, calls)
+	assert.Equal(t, []error{context.Canceled}, reported)
+	assert.EqualValues(t, 0, logger.Stats().EventsAccepted)
+	assert.EqualValues(t, 1, logger.Stats().EventsDropped)
+}
+
+func TestLogCtxCancelledWhileBlocked(t *testing.T) {
+	var mu sync.Mutex
+	var messages []string
+	var reported []error
+	release := make(chan struct{})
+	config := &Config{
+		LogGroupName:  "test",
+		FlushInterval: time.Millisecond,
+		MaxQueueSize:  1,
+		ErrorReporter: func(err error) {
+			mu.Lock()
+			reported = append(reported, err)
+			mu.Unlock()
+		},
+	}
+
+	logger := newLoggerWithServer(config, blockedServer(release, &mu, &messages))
+
+	// Log until the pipeline backs up and a log message is abandoned.
+	var abandoned string
+	for i := 0; i < 1000 && abandoned == ""; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		logger.LogCtx(ctx, time.Now(), strconv.Itoa(i))
+		cancel()
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		if len(reported) > 0 {
+			abandoned = strconv.Itoa(i)
+		}
+		mu.Unlock()
+	}
+
+	close(release)
+	logger.Close()
+
+	assert.Equal(t, []error{context.DeadlineExceeded}, reported)
+	assert.NotEmpty(t, abandoned)
+	assert.NotContains(t, messages, abandoned)
+}
@@ -0,0 +1,106 @@
+package cwlogger
+
+import (
+	"sync"
+	"time"
+)
+
+// A rateLimiter is a token bucket limiting the rate at which bytes are written,
+// allowing bursts of up to one second's worth of bytes. It is safe for
+// concurrent use, so that Loggers sharing it are limited together.
+type rateLimiter struct {
+	mu     sync.Mutex // guards tokens and last, but isn't held while waiting
+	rate   float64    // bytes per second
+	tokens float64
+	last   time.Time
+	clock  clock
+}
+
+func newRateLimiter(bytesPerSecond int, clock clock) *rateLimiter {
+	return &rateLimiter{
+		rate:   float64(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		last:   clock.Now(),
+		clock:  clock,
+	}
+}
+
+// wait blocks until n bytes may be written. Batches larger than the bucket are
+// let through once the bucket has refilled enough to pay for them. Concurrent
+// callers each pay for their bytes up front, so each waits for the bytes of
+// those before it as well as its own.
+func (l *rateLimiter) wait(n int) {
+	l.mu.Lock()
+	now := l.clock.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+
+	l.tokens -= float64(n)
+	tokens := l.tokens
+	l.mu.Unlock()
+
+	if tokens < 0 {
+		<-l.clock.After(time.Duration(-tokens / l.rate * float64(time.Second)))
+	}
+}
+
+// rateLimitReportInterval is the minimum time between reports of
+// ErrRateLimited to the ErrorReporter.
+const rateLimitReportInterval = time.Second
+
+// An eventLimiter is a token bucket limiting the rate at which log events are
+// enqueued, allowing bursts of up to one second's worth of log events. Unlike
+// a rateLimiter it drops excess log events rather than waiting, and is safe
+// for concurrent use.
+type eventLimiter struct {
+	mu       sync.Mutex
+	rate     float64 // log events per second
+	tokens   float64
+	last     time.Time
+	reported time.Time // when ErrRateLimited was last reported
+	clock    clock
+}
+
+func newEventLimiter(eventsPerSecond int, clock clock) *eventLimiter {
+	return &eventLimiter{
+		rate:   float64(eventsPerSecond),
+		tokens: float64(eventsPerSecond),
+		last:   clock.Now(),
+		clock:  clock,
+	}
+}
+
+// allow reports whether a log event may be enqueued, taking a token if so.
+func (l *eventLimiter) allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// report reports whether a dropped log event should be reported to the
+// ErrorReporter, which it should unless one was reported within the last
+// rateLimitReportInterval.
+func (l *eventLimiter) report() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	if !l.reported.IsZero() && now.Sub(l.reported) < rateLimitReportInterval {
+		return false
+	}
+	l.reported = now
+	return true
+}
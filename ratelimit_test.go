@@ -0,0 +1,223 @@
+package cwlogger
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterWaitsForTokens(t *testing.T) {
+	clk := newFakeClock(time.Now())
+	l := newRateLimiter(1000, clk)
+
+	waited := make(chan struct{})
+	go func() {
+		l.wait(1000) // the initial burst
+		l.wait(500)
+		close(waited)
+	}()
+
+	assert.Eventually(t, func() bool { return clk.Timers() == 1 }, time.Second, time.Millisecond)
+	clk.Advance(499 * time.Millisecond)
+	select {
+	case <-waited:
+		t.Fatal("wait returned before enough tokens accrued")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	clk.Advance(time.Millisecond)
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("wait did not return once enough tokens accrued")
+	}
+}
+
+func TestMaxBytesPerSecond(t *testing.T) {
+	const rate = 200 * 1024
+
+	type put struct {
+		at    time.Time
+		bytes int
+	}
+	var mu sync.Mutex
+	var puts []put
+	config := &Config{
+		LogGroupName:      "test",
+		FlushInterval:     time.Millisecond,
+		MaxBytesPerSecond: rate,
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			var data PutLogEvents
+			parseBody(r, &data)
+			bytes := 0
+			for _, event := range data.LogEvents {
+				bytes += eventSize(event.Message)
+			}
+			mu.Lock()
+			puts = append(puts, put{time.Now(), bytes})
+			mu.Unlock()
+		}
+	})
+
+	start := time.Now()
+	message := strings.Repeat(".", 10*1024-logEventOverhead)
+	for i := 0; i < 30; i++ {
+		logger.Log(time.Now(), message)
+	}
+	logger.Close()
+
+	total := 0
+	for _, p := range puts {
+		total += p.bytes
+		allowed := rate + rate*p.at.Sub(start).Seconds()
+		assert.True(t, float64(total) <= allowed, "%d bytes sent after %s", total, p.at.Sub(start))
+	}
+	assert.Equal(t, 30*10*1024, total)
+	assert.True(t, time.Since(start) >= 400*time.Millisecond, "burst sent in %s", time.Since(start))
+}
+
+func TestMaxEventsPerSecond(t *testing.T) {
+	clk := newFakeClock(time.Now())
+	client := new(mockClient)
+	var mu sync.Mutex
+	var reported []error
+	logger, err := New(&Config{
+		Client:             client,
+		LogGroupName:       "test",
+		MaxEventsPerSecond: 3,
+		ErrorReporter: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			reported = append(reported, err)
+		},
+		clock: clk,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for i := 0; i < 5; i++ {
+		logger.Log(clk.Now(), "burst "+strconv.Itoa(i))
+	}
+	assert.ErrorIs(t, logger.LogE(clk.Now(), "burst 5"), ErrRateLimited)
+
+	// Tokens accrue with time, and the rate limit is reported again once a
+	// second has passed.
+	clk.Advance(time.Second / 2)
+	assert.NoError(t, logger.LogE(clk.Now(), "later"))
+	clk.Advance(time.Second)
+	logger.Log(clk.Now(), "last")
+	logger.Close()
+
+	assert.Equal(t, []string{"burst 0", "burst 1", "burst 2", "later", "last"}, client.messages[logger.StreamNames()[0]])
+	assert.Equal(t, int64(3), logger.Stats().EventsDropped)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []error{ErrRateLimited}, reported)
+}
+
+func TestMaxEventsPerSecondIsSharedWithLogToStream(t *testing.T) {
+	clk := newFakeClock(time.Now())
+	client := new(mockClient)
+	logger, err := New(&Config{
+		Client:             client,
+		LogGroupName:       "test",
+		MaxEventsPerSecond: 2,
+		clock:              clk,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	logger.Log(clk.Now(), "default")
+	logger.LogToStream("tenant-a", clk.Now(), "first a")
+	logger.LogToStream("tenant-a", clk.Now(), "second a")
+	assert.ErrorIs(t, logger.LogE(clk.Now(), "limited"), ErrRateLimited)
+	logger.Close()
+
+	assert.Equal(t, []string{"default"}, client.messages[logger.StreamNames()[0]])
+	assert.Equal(t, []string{"first a"}, client.messages["tenant-a"])
+	stats := logger.Stats()
+	assert.EqualValues(t, 2, stats.EventsAccepted)
+	assert.EqualValues(t, 2, stats.EventsDropped)
+}
+
+func TestMaxBytesPerSecondIsSharedWithLogToStream(t *testing.T) {
+	client := new(mockClient)
+	logger, err := New(&Config{
+		Client:            client,
+		LogGroupName:      "test",
+		FlushInterval:     time.Millisecond,
+		MaxBytesPerSecond: 1024 * 1024,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, stream := range []string{"", "tenant-a", "tenant-b"} {
+		wg.Add(1)
+		go func(stream string) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if stream == "" {
+					logger.Log(time.Now(), "message")
+				} else {
+					logger.LogToStream(stream, time.Now(), "message")
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}(stream)
+	}
+	wg.Wait()
+	logger.Close()
+
+	assert.Len(t, client.messages[logger.StreamNames()[0]], 50)
+	assert.Len(t, client.messages["tenant-a"], 50)
+	assert.Len(t, client.messages["tenant-b"], 50)
+}
+
+func TestMaxBytesPerSecondCountsRetries(t *testing.T) {
+	withoutJitter(t, time.Millisecond)
+	const rate = 1024
+	clk := newFakeClock(time.Now())
+	client := &failingClient{mockClient: new(mockClient), failing: true}
+	logger, err := New(&Config{
+		Client:            client,
+		LogGroupName:      "test",
+		MaxBytesPerSecond: rate,
+		clock:             clk,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// The first attempt uses up the burst, so the retry waits for another
+	// second's worth of bytes.
+	logger.Log(clk.Now(), strings.Repeat(".", rate-logEventOverhead))
+	flushed := logger.FlushAsync()
+	puts := func() int {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return client.puts
+	}
+	assert.Eventually(t, func() bool { return puts() == 1 }, time.Second, time.Millisecond)
+	client.mu.Lock()
+	client.failing = false
+	client.mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 1, puts(), "the retry was sent without waiting for the rate limit")
+
+	clk.Advance(time.Second)
+	assert.NoError(t, <-flushed)
+	assert.Equal(t, 2, puts())
+	logger.Close()
+}
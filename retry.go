@@ -0,0 +1,142 @@
+package cwlogger
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/smithy-go"
+)
+
+const defaultMaxRetries = 5
+
+var (
+	// retryBaseDelay and retryMaxDelay bound the backoff between attempts to
+	// write a batch.
+	retryBaseDelay = 100 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+
+	// jitter returns a random duration in [0, n).
+	jitter = func(n time.Duration) time.Duration {
+		return time.Duration(rand.Int63n(int64(n)))
+	}
+)
+
+// A RetryDecision determines what the Logger does with a batch that failed to
+// be written.
+type RetryDecision int
+
+const (
+	// Retry retries the batch with backoff, up to MaxRetries times.
+	Retry RetryDecision = iota
+
+	// Drop drops the batch, reporting it as a *DroppedBatchError.
+	Drop
+
+	// NewStream creates an additional log stream to spread the load over,
+	// then retries the batch like Retry. It is the same as Retry when the
+	// Logger writes to a single log stream.
+	NewStream
+
+	// RefreshCredentials invalidates the Client's cached credentials, so that
+	// they are retrieved again from the credentials provider, then retries the
+	// batch like Retry.
+	RefreshCredentials
+)
+
+// DefaultRetryClassifier decides what to do with a batch that failed to be
+// written with err when no RetryClassifier is configured. Throttling errors
+// get a NewStream, authentication failures from expired credentials get a
+// RefreshCredentials, and errors such as connection failures, internal
+// failures and unavailability, or invalid sequence tokens, are retried.
+// Batches failing because the log group or log stream was deleted are retried
+// once it is recreated. Other errors cause the batch to be dropped.
+//
+// A RetryClassifier can fall back to DefaultRetryClassifier for the errors it
+// doesn't handle itself.
+func DefaultRetryClassifier(err error) RetryDecision {
+	switch {
+	case isErrorCode(err, errCodeThrottlingException):
+		return NewStream
+	case isCredentialsError(err):
+		return RefreshCredentials
+	case isErrorCode(err, errCodeResourceNotFoundException), shouldRetry(err):
+		return Retry
+	}
+	return Drop
+}
+
+// A pendingBatch is a batch of log events waiting to be written, along with
+// the number of failed attempts to write it.
+type pendingBatch struct {
+	logEvents  []types.InputLogEvent
+	dones      []chan<- error // of the log events waiting on the outcome
+	doneEvents []int          // the index in logEvents each of dones waits on
+	coalesced  int            // log events coalesced into others in logEvents
+	slot       int            // of the log events, see logEvent
+	attempts   int
+}
+
+// events returns the number of log events accepted by the Logger that the
+// batch holds, including those coalesced into others.
+func (b *pendingBatch) events() int {
+	return len(b.logEvents) + b.coalesced
+}
+
+// finish delivers the outcome of writing the batch to the log events waiting
+// on it.
+func (b *pendingBatch) finish(err error) {
+	for _, done := range b.dones {
+		done <- err
+	}
+}
+
+// finishWritten delivers the outcome of writing the batch successfully to the
+// log events waiting on it: nil, or the error of those CloudWatch Logs
+// rejected nonetheless.
+func (b *pendingBatch) finishWritten(rejected []rejection) {
+	for k, done := range b.dones {
+		var err error
+		for _, r := range rejected {
+			if b.doneEvents[k] >= r.start && b.doneEvents[k] < r.end {
+				err = r.err
+				break
+			}
+		}
+		done <- err
+	}
+}
+
+// retryDelay returns how long to wait before retrying a batch after the given
+// number of failed attempts, using exponential backoff with full jitter.
+func retryDelay(attempts int) time.Duration {
+	ceiling := retryMaxDelay
+	if attempts < 32 {
+		if d := retryBaseDelay << uint(attempts-1); d > 0 && d < ceiling {
+			ceiling = d
+		}
+	}
+	return jitter(ceiling)
+}
+
+// retryAborted calls fn, retrying with backoff up to the Logger's maxRetries
+// times while it fails with OperationAbortedException, which CloudWatch Logs
+// returns when a conflicting operation on the same resource is in progress,
+// for example when several processes create the same log group at once.
+func (lg *Logger) retryAborted(ctx context.Context, fn func() error) error {
+	for attempts := 1; ; attempts++ {
+		err := fn()
+		var apiErr smithy.APIError
+		if !errors.As(err, &apiErr) || apiErr.ErrorCode() != errCodeOperationAbortedException || attempts > lg.maxRetries {
+			return err
+		}
+		lg.debugLogger("cwlogger: operation aborted, retrying: %v", err)
+		select {
+		case <-time.After(retryDelay(attempts)):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
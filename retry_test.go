@@ -0,0 +1,359 @@
+package cwlogger
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/stretchr/testify/assert"
+)
+
+// withoutJitter makes retry delays deterministic for the duration of a test.
+func withoutJitter(t *testing.T, base time.Duration) {
+	oldBase, oldJitter := retryBaseDelay, jitter
+	retryBaseDelay = base
+	jitter = func(n time.Duration) time.Duration { return n }
+	t.Cleanup(func() {
+		retryBaseDelay, jitter = oldBase, oldJitter
+	})
+}
+
+func TestRetryDelayGrowsExponentially(t *testing.T) {
+	withoutJitter(t, 100*time.Millisecond)
+
+	assert.Equal(t, 100*time.Millisecond, retryDelay(1))
+	assert.Equal(t, 200*time.Millisecond, retryDelay(2))
+	assert.Equal(t, 400*time.Millisecond, retryDelay(3))
+	assert.Equal(t, 30*time.Second, retryDelay(10))
+	assert.Equal(t, 30*time.Second, retryDelay(100))
+}
+
+func TestRetryBacksOffUntilBatchLands(t *testing.T) {
+	withoutJitter(t, 20*time.Millisecond)
+
+	var calls []time.Time
+	var delivered []string
+
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			calls = append(calls, time.Now())
+			if len(calls) <= 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte(`{"__type":"ServiceUnavailableException"}`))
+				return
+			}
+			var data PutLogEvents
+			parseBody(r, &data)
+			for _, event := range data.LogEvents {
+				delivered = append(delivered, event.Message)
+			}
+			w.Write([]byte(`{"nextSequenceToken":"1"}`))
+		}
+	})
+
+	logger.Log(time.Now(), "message")
+	logger.Close()
+
+	assert.Equal(t, []string{"message"}, delivered)
+	if assert.Len(t, calls, 4) {
+		for i, min := range []time.Duration{20, 40, 80} {
+			gap := calls[i+1].Sub(calls[i])
+			assert.True(t, gap >= min*time.Millisecond, "retry %d after %s", i+1, gap)
+		}
+	}
+	assert.EqualValues(t, 3, logger.Stats().BatchesRetried)
+}
+
+func TestRetryGivesUpAfterMaxRetries(t *testing.T) {
+	withoutJitter(t, time.Millisecond)
+
+	var calls int
+	var reported []error
+	config := &Config{
+		LogGroupName: "test",
+		MaxRetries:   2,
+		ErrorReporter: func(err error) {
+			reported = append(reported, err)
+		},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			calls++
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"__type":"ServiceUnavailableException"}`))
+		}
+	})
+
+	logger.Log(time.Now(), "message")
+	logger.Close()
+
+	assert.Equal(t, 3, calls)
+	if assert.Len(t, reported, 1) {
+		assert.True(t, errors.Is(reported[0], Error{Code: "ServiceUnavailableException"}))
+	}
+	assert.EqualValues(t, 1, logger.Stats().EventsDropped)
+}
+
+func TestRetryClassifierDrops(t *testing.T) {
+	withoutJitter(t, time.Millisecond)
+
+	var calls int
+	var classified []error
+	var reported []error
+	config := &Config{
+		LogGroupName: "test",
+		RetryClassifier: func(err error) RetryDecision {
+			classified = append(classified, err)
+			var apiErr Error
+			if errors.As(err, &apiErr) && apiErr.Code == "ServiceUnavailableException" {
+				return Drop
+			}
+			return DefaultRetryClassifier(err)
+		},
+		ErrorReporter: func(err error) {
+			reported = append(reported, err)
+		},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			calls++
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"__type":"ServiceUnavailableException"}`))
+		}
+	})
+
+	logger.Log(time.Now(), "message")
+	logger.Close()
+
+	assert.Equal(t, 1, calls)
+	assert.Len(t, classified, 1)
+	if assert.Len(t, reported, 1) {
+		var dropped *DroppedBatchError
+		assert.True(t, errors.As(reported[0], &dropped))
+	}
+	assert.EqualValues(t, 0, logger.Stats().BatchesRetried)
+}
+
+func TestDefaultRetryClassifier(t *testing.T) {
+	assert.Equal(t, NewStream, DefaultRetryClassifier(Error{Code: "ThrottlingException"}))
+	assert.Equal(t, Retry, DefaultRetryClassifier(Error{Code: "ServiceUnavailableException"}))
+	assert.Equal(t, Retry, DefaultRetryClassifier(Error{Code: "ResourceNotFoundException"}))
+	assert.Equal(t, RefreshCredentials, DefaultRetryClassifier(Error{Code: "ExpiredTokenException"}))
+	assert.Equal(t, RefreshCredentials, DefaultRetryClassifier(Error{Code: "UnrecognizedClientException"}))
+	assert.Equal(t, Retry, DefaultRetryClassifier(errors.New("connection reset")))
+	assert.Equal(t, Drop, DefaultRetryClassifier(Error{Code: "InvalidParameterException"}))
+}
+
+func TestMaxClientAttempts(t *testing.T) {
+	var calls int
+	var reported []error
+	config := &Config{
+		LogGroupName:      "test",
+		MaxRetries:        -1,
+		MaxClientAttempts: 4,
+		ClientOptions: []func(*cloudwatchlogs.Options){
+			func(o *cloudwatchlogs.Options) {
+				o.Retryer = retry.NewStandard(func(so *retry.StandardOptions) {
+					so.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return 0, nil })
+					so.RateLimiter = ratelimit.None
+				})
+			},
+		},
+		ErrorReporter: func(err error) {
+			reported = append(reported, err)
+		},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			calls++
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"__type":"ServiceUnavailableException"}`))
+		}
+	})
+
+	logger.Log(time.Now(), "message")
+	logger.Close()
+
+	assert.Equal(t, 4, calls)
+	assert.Len(t, reported, 1)
+	assert.EqualValues(t, 0, logger.Stats().BatchesRetried)
+}
+
+func TestDroppedBatchErrorCarriesLogEvents(t *testing.T) {
+	var reported []error
+	config := &Config{
+		LogGroupName: "test",
+		ErrorReporter: func(err error) {
+			reported = append(reported, err)
+		},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"InvalidParameterException"}`))
+		}
+	})
+
+	logger.Log(time.Now(), "first")
+	logger.Log(time.Now(), "second")
+	logger.Close()
+
+	if !assert.Len(t, reported, 1) {
+		return
+	}
+	var dropped *DroppedBatchError
+	if assert.True(t, errors.As(reported[0], &dropped)) {
+		assert.Equal(t, Error{Code: "InvalidParameterException"}, dropped.Err)
+		var messages []string
+		for _, event := range dropped.LogEvents {
+			messages = append(messages, aws.ToString(event.Message))
+		}
+		assert.Equal(t, []string{"first", "second"}, messages)
+	}
+	assert.Equal(t, "cwlogger: dropped 2 log events: InvalidParameterException", reported[0].Error())
+}
+
+func TestDroppedBatchReportedBeforeFlushReturns(t *testing.T) {
+	client := &failingClient{mockClient: new(mockClient), failing: true}
+	var reported []error
+	logger, err := New(&Config{
+		Client:       client,
+		LogGroupName: "test",
+		MaxRetries:   -1,
+		ErrorReporter: func(err error) {
+			reported = append(reported, err)
+		},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer logger.Close()
+
+	// The drop is reported by the time LogSync, Flush and WaitUntilIdle return.
+	assert.Error(t, logger.LogSync(context.Background(), time.Now(), "first"))
+	assert.Len(t, reported, 1)
+
+	logger.Log(time.Now(), "second")
+	logger.Flush()
+	assert.Len(t, reported, 2)
+
+	logger.Log(time.Now(), "third")
+	assert.NoError(t, logger.WaitUntilIdle(context.Background()))
+	assert.Len(t, reported, 3)
+}
+
+func TestCallTimeoutIsRetried(t *testing.T) {
+	withoutJitter(t, time.Millisecond)
+
+	// The first PutLogEvents call is still being handled when it is retried.
+	var mu sync.Mutex
+	var calls int
+	var delivered []string
+	var reported []error
+	config := &Config{
+		LogGroupName: "test",
+		CallTimeout:  50 * time.Millisecond,
+		MaxRetries:   1,
+		ErrorReporter: func(err error) {
+			reported = append(reported, err)
+		},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			mu.Lock()
+			calls++
+			first := calls == 1
+			mu.Unlock()
+			if first {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(time.Second):
+				}
+				return
+			}
+			var data PutLogEvents
+			parseBody(r, &data)
+			mu.Lock()
+			for _, event := range data.LogEvents {
+				delivered = append(delivered, event.Message)
+			}
+			mu.Unlock()
+			w.Write([]byte(`{"nextSequenceToken":"1"}`))
+		}
+	})
+
+	start := time.Now()
+	logger.Log(time.Now(), "message")
+	logger.Close()
+
+	assert.True(t, time.Since(start) < time.Second, "PutLogEvents was not timed out")
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"message"}, delivered)
+	assert.Empty(t, reported)
+	assert.EqualValues(t, 1, logger.Stats().BatchesRetried)
+}
+
+func TestCallTimeoutIsReported(t *testing.T) {
+	var reported []error
+	config := &Config{
+		LogGroupName: "test",
+		CallTimeout:  20 * time.Millisecond,
+		MaxRetries:   -1,
+		ErrorReporter: func(err error) {
+			reported = append(reported, err)
+		},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		}
+	})
+
+	logger.Log(time.Now(), "message")
+	logger.Close()
+
+	if assert.Len(t, reported, 1) {
+		assert.True(t, errors.Is(reported[0], context.DeadlineExceeded), "unexpected error: %v", reported[0])
+	}
+}
+
+func TestOperationAbortedIsRetried(t *testing.T) {
+	withoutJitter(t, time.Millisecond)
+	var actions []string
+	aborted := map[string]bool{}
+
+	logger, err := New(&Config{
+		Client: newClientWithServer(func(w http.ResponseWriter, r *http.Request) {
+			actions = append(actions, action(r))
+			if (action(r) == "CreateLogGroup" || action(r) == "CreateLogStream") && !aborted[action(r)] {
+				aborted[action(r)] = true
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"__type":"OperationAbortedException"}`))
+			}
+		}),
+		LogGroupName: "test",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	logger.Close()
+
+	assert.Equal(t, []string{"CreateLogGroup", "CreateLogGroup", "CreateLogStream", "CreateLogStream"}, actions)
+}
@@ -0,0 +1,103 @@
+package cwlogger
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Rotation configures when the Logger retires a log stream in favour of a newly
+// created one. A zero value for either threshold disables it.
+type Rotation struct {
+	// Rotate a log stream once the Logger has been writing to it for this long.
+	Age time.Duration
+
+	// Rotate a log stream once this many bytes of log events have been written
+	// to it.
+	Bytes int64
+}
+
+// due reports whether stream has crossed either of the rotation thresholds at
+// the given time.
+func (r Rotation) due(stream *logStream, now time.Time) bool {
+	if r.Age > 0 && now.Sub(stream.started) >= r.Age {
+		return true
+	}
+	if r.Bytes > 0 && atomic.LoadInt64(&stream.bytesWritten) >= r.Bytes {
+		return true
+	}
+	return false
+}
+
+// rotate replaces the log stream at index i with a newly created one. The old
+// log stream's writer exits once it has finished any batch in flight.
+//
+// If the new log stream can't be created the error is reported, and the old
+// log stream remains in use.
+func (ls *logStreams) rotate(i int) {
+	old := ls.streams[i]
+	stream, err := ls.replace(i)
+	if err != nil {
+		ls.logger.onError(ErrorEvent{
+			Phase:  PhaseCreate,
+			Stream: *old.name,
+			Err:    fmt.Errorf("cwlogger: unable to rotate log stream %q: %w", *old.name, err),
+		})
+		return
+	}
+	ls.logger.debugLogger("cwlogger: rotated log stream %q to %q", *old.name, *stream.name)
+}
+
+// quarantine replaces a log stream that has failed too many consecutive
+// writes with a newly created one, unless it has already been replaced.
+//
+// If the new log stream can't be created the error is reported, and the old
+// log stream remains in use.
+func (ls *logStreams) quarantine(old *logStream) {
+	for i, stream := range ls.streams {
+		if stream != old {
+			continue
+		}
+		stream, err := ls.replace(i)
+		if err != nil {
+			ls.logger.onError(ErrorEvent{
+				Phase:  PhaseCreate,
+				Stream: *old.name,
+				Err:    fmt.Errorf("cwlogger: unable to replace failing log stream %q: %w", *old.name, err),
+			})
+			return
+		}
+		atomic.AddInt64(&ls.logger.stats.streamsQuarantined, 1)
+		ls.logger.debugLogger("cwlogger: replaced log stream %q, which failed %d consecutive writes, with %q",
+			*old.name, atomic.LoadInt64(&old.failures), *stream.name)
+		return
+	}
+}
+
+// replace replaces the log stream at index i with a newly created one,
+// returning it. The old log stream's writer exits once it has finished any
+// batch in flight. With CleanupEmptyStreams the old log stream is kept for
+// deleteEmpty.
+func (ls *logStreams) replace(i int) (*logStream, error) {
+	old := ls.streams[i]
+	name := ls.logger.streamNameFn(ls.added)
+	stream := &logStream{
+		name:   &name,
+		logger: ls.logger,
+	}
+	if err := stream.create(context.Background()); err != nil {
+		return nil, err
+	}
+
+	ls.mu.Lock()
+	ls.streams[i] = stream
+	if ls.logger.cleanupEmpty && old.created {
+		ls.retired = append(ls.retired, old)
+	}
+	ls.mu.Unlock()
+	close(ls.writers[old])
+	delete(ls.writers, old)
+	ls.start(stream)
+	return stream, nil
+}
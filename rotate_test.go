@@ -0,0 +1,166 @@
+package cwlogger
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotateAfterBytes(t *testing.T) {
+	var created, written []string
+	config := &Config{
+		LogGroupName: "test",
+		RotateAfter:  Rotation{Bytes: 100},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		switch action(r) {
+		case "CreateLogStream":
+			var req CreateLogStream
+			parseBody(r, &req)
+			created = append(created, req.LogStreamName)
+		case "PutLogEvents":
+			var req PutLogEvents
+			parseBody(r, &req)
+			written = append(written, req.LogStreamName)
+		}
+	})
+
+	for i := 0; i < 3; i++ {
+		logger.Log(time.Now(), "a message longer than the rotation threshold of one hundred bytes, so it rotates")
+		logger.Flush()
+	}
+	logger.Close()
+
+	if assert.Len(t, created, 3) {
+		assert.Equal(t, created, written)
+		assert.NotEqual(t, created[0], created[1])
+		assert.NotEqual(t, created[1], created[2])
+	}
+	assert.Equal(t, []string{created[2]}, logger.StreamNames())
+	assert.Equal(t, int64(1), logger.Stats().CurrentStreams)
+}
+
+func TestRotateAfterAge(t *testing.T) {
+	now := time.Now()
+	stream := &logStream{started: now.Add(-time.Hour)}
+
+	assert.False(t, Rotation{}.due(stream, now))
+	assert.False(t, Rotation{Age: 2 * time.Hour}.due(stream, now))
+	assert.True(t, Rotation{Age: time.Hour}.due(stream, now))
+}
+
+func TestRotateIgnoredWithLogStreamName(t *testing.T) {
+	var creates int
+	config := &Config{
+		LogGroupName:  "test",
+		LogStreamName: "fixed",
+		RotateAfter:   Rotation{Bytes: 1},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		switch action(r) {
+		case "DescribeLogStreams":
+			w.Write([]byte(`{"logStreams":[]}`))
+		case "CreateLogStream":
+			creates++
+		}
+	})
+
+	for i := 0; i < 3; i++ {
+		logger.Log(time.Now(), "message")
+		logger.Flush()
+	}
+	logger.Close()
+
+	assert.Equal(t, 1, creates)
+}
+
+func TestQuarantineAfter(t *testing.T) {
+	withoutJitter(t, time.Millisecond)
+	var mu sync.Mutex
+	var delivered []string
+	writes := make(map[string]int)
+	config := &Config{
+		LogGroupName:    "test",
+		Streams:         2,
+		QuarantineAfter: 2,
+		StreamNameFunc:  func(index int) string { return "stream-" + strconv.Itoa(index) },
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			var req PutLogEvents
+			parseBody(r, &req)
+			mu.Lock()
+			defer mu.Unlock()
+			writes[req.LogStreamName]++
+			if req.LogStreamName == "stream-0" {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte(`{"__type":"ServiceUnavailableException"}`))
+				return
+			}
+			for _, event := range req.LogEvents {
+				delivered = append(delivered, event.Message)
+			}
+		}
+	})
+
+	var messages []string
+	for i := 0; i < 6; i++ {
+		message := "message " + strconv.Itoa(i)
+		messages = append(messages, message)
+		logger.Log(time.Now(), message)
+		logger.Flush()
+	}
+	logger.Close()
+
+	assert.Equal(t, []string{"stream-2", "stream-1"}, logger.StreamNames())
+	assert.Equal(t, 2, writes["stream-0"], "the failing log stream was written to after being replaced")
+	assert.Positive(t, writes["stream-2"])
+	assert.ElementsMatch(t, messages, delivered)
+	assert.EqualValues(t, 1, logger.Stats().StreamsQuarantined)
+}
+
+// streamFailingClient is a mockClient whose PutLogEvents calls to the log
+// stream named failing fail.
+type streamFailingClient struct {
+	*mockClient
+	failing string
+}
+
+func (c *streamFailingClient) PutLogEvents(ctx context.Context, params *cloudwatchlogs.PutLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutLogEventsOutput, error) {
+	if *params.LogStreamName == c.failing {
+		return nil, &types.ServiceUnavailableException{}
+	}
+	return c.mockClient.PutLogEvents(ctx, params, optFns...)
+}
+
+func TestCleanupQuarantinedStreams(t *testing.T) {
+	withoutJitter(t, time.Millisecond)
+	client := &streamFailingClient{mockClient: new(mockClient), failing: "stream-0"}
+	logger, err := New(&Config{
+		Client:              client,
+		LogGroupName:        "test",
+		QuarantineAfter:     2,
+		CleanupEmptyStreams: true,
+		StreamNameFunc:      func(index int) string { return "stream-" + strconv.Itoa(index) },
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	logger.Log(time.Now(), "message")
+	logger.Close()
+
+	assert.Equal(t, []string{"stream-1"}, logger.StreamNames())
+	assert.Equal(t, []string{"message"}, client.messages["stream-1"])
+	assert.Equal(t, []string{"stream-0"}, client.deleted)
+}
@@ -0,0 +1,44 @@
+package cwlogger
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// notifySignals and stopSignals are replaced in tests to simulate signals.
+var (
+	notifySignals = signal.Notify
+	stopSignals   = signal.Stop
+)
+
+// CloseOnSignal drains and closes the Logger like Close when the process
+// receives any of the given signals, for example syscall.SIGTERM, so that log
+// messages aren't lost when a container is stopped. It returns a function that
+// stops handling the signals, which should be called if the Logger is closed
+// otherwise.
+//
+// Like signal.Notify, handling a signal stops it from terminating the process
+// by default, so the application should handle the signals as well to shut
+// down. Signals delivered to the application's own channels are unaffected.
+func (lg *Logger) CloseOnSignal(sigs ...os.Signal) (stop func()) {
+	c := make(chan os.Signal, 1)
+	notifySignals(c, sigs...)
+	unregister := stopSignals
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-c:
+			lg.debugLogger("cwlogger: closing on signal %v", sig)
+			lg.Close()
+		case <-done:
+		}
+		unregister(c)
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
@@ -0,0 +1,89 @@
+package cwlogger
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSignals replaces signal handling for the duration of a test, returning a
+// function that delivers a signal to the channels registered for it.
+func fakeSignals(t *testing.T) (send func(os.Signal) bool) {
+	var mu sync.Mutex
+	registered := map[chan<- os.Signal][]os.Signal{}
+
+	oldNotify, oldStop := notifySignals, stopSignals
+	notifySignals = func(c chan<- os.Signal, sigs ...os.Signal) {
+		mu.Lock()
+		defer mu.Unlock()
+		registered[c] = sigs
+	}
+	stopSignals = func(c chan<- os.Signal) {
+		mu.Lock()
+		defer mu.Unlock()
+		delete(registered, c)
+	}
+	t.Cleanup(func() {
+		notifySignals, stopSignals = oldNotify, oldStop
+	})
+
+	return func(sig os.Signal) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		sent := false
+		for c, sigs := range registered {
+			for _, s := range sigs {
+				if s == sig {
+					c <- sig
+					sent = true
+				}
+			}
+		}
+		return sent
+	}
+}
+
+func TestCloseOnSignal(t *testing.T) {
+	send := fakeSignals(t)
+	client := new(mockClient)
+	logger, err := New(&Config{
+		Client:       client,
+		LogGroupName: "test",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	logger.CloseOnSignal(os.Interrupt)
+	logger.Log(time.Now(), "message")
+	assert.True(t, send(os.Interrupt))
+
+	assert.Eventually(t, func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return len(client.messages[logger.StreamNames()[0]]) == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, ErrClosed, logger.LogE(time.Now(), "after"))
+}
+
+func TestCloseOnSignalStopped(t *testing.T) {
+	send := fakeSignals(t)
+	logger, err := New(&Config{
+		Client:       new(mockClient),
+		LogGroupName: "test",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer logger.Close()
+
+	stop := logger.CloseOnSignal(os.Interrupt)
+	stop()
+	stop()
+
+	assert.Eventually(t, func() bool { return !send(os.Interrupt) }, time.Second, time.Millisecond)
+	assert.NoError(t, logger.LogE(time.Now(), "message"))
+}
@@ -0,0 +1,77 @@
+package cwlogger
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+)
+
+// NewSlogHandler returns a slog.Handler that writes each record to lg as a
+// JSON object, timestamped with the record's time. Records are formatted as
+// by slog.JSONHandler with the given options, which may be nil.
+func NewSlogHandler(lg *Logger, opts *slog.HandlerOptions) slog.Handler {
+	h := &slogHandler{logger: lg}
+	if opts != nil {
+		h.opts = *opts
+	}
+	return h
+}
+
+type slogHandler struct {
+	logger *Logger
+	opts   slog.HandlerOptions
+
+	// wrap holds the WithAttrs and WithGroup calls made on the handler, which
+	// are replayed on the JSON handler used to format each record.
+	wrap []func(slog.Handler) slog.Handler
+}
+
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.opts.Level != nil {
+		minLevel = h.opts.Level.Level()
+	}
+	return level >= minLevel
+}
+
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	var buf bytes.Buffer
+	var jh slog.Handler = slog.NewJSONHandler(&buf, &h.opts)
+	for _, wrap := range h.wrap {
+		jh = wrap(jh)
+	}
+	if err := jh.Handle(ctx, r); err != nil {
+		return err
+	}
+
+	t := r.Time
+	if t.IsZero() {
+		t = h.logger.clock.Now()
+	}
+	return h.logger.LogE(t, strings.TrimSuffix(buf.String(), "\n"))
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return h.with(func(jh slog.Handler) slog.Handler {
+		return jh.WithAttrs(attrs)
+	})
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return h.with(func(jh slog.Handler) slog.Handler {
+		return jh.WithGroup(name)
+	})
+}
+
+func (h *slogHandler) with(wrap func(slog.Handler) slog.Handler) *slogHandler {
+	h2 := *h
+	h2.wrap = append(h.wrap[:len(h.wrap):len(h.wrap)], wrap)
+	return &h2
+}
@@ -0,0 +1,55 @@
+package cwlogger
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlogHandler(t *testing.T) {
+	var events []*InputLogEvent
+
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			var data PutLogEvents
+			parseBody(r, &data)
+			events = append(events, data.LogEvents...)
+			w.Write([]byte(`{"nextSequenceToken":"1"}`))
+		}
+	})
+
+	l := slog.New(NewSlogHandler(logger, nil))
+	l.With("service", "api").WithGroup("request").With("id", 7).Info("handled", "path", "/users")
+	l.Debug("ignored")
+	logger.Close()
+
+	if !assert.Len(t, events, 1) {
+		return
+	}
+
+	var payload map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(events[0].Message), &payload))
+	assert.Equal(t, "INFO", payload["level"])
+	assert.Equal(t, "handled", payload["msg"])
+	assert.Equal(t, "api", payload["service"])
+	assert.Equal(t, map[string]interface{}{"id": float64(7), "path": "/users"}, payload["request"])
+
+	timestamp, err := time.Parse(time.RFC3339Nano, payload["time"].(string))
+	assert.NoError(t, err)
+	assert.Equal(t, timestamp.UnixNano()/int64(time.Millisecond), events[0].Timestamp)
+}
+
+func TestSlogHandlerLevel(t *testing.T) {
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {})
+	defer logger.Close()
+
+	h := NewSlogHandler(logger, &slog.HandlerOptions{Level: slog.LevelWarn})
+
+	assert.False(t, h.Enabled(context.Background(), slog.LevelInfo))
+	assert.True(t, h.Enabled(context.Background(), slog.LevelError))
+}
@@ -0,0 +1,111 @@
+package cwlogger
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats contains counters describing the activity of a Logger since it was
+// created.
+type Stats struct {
+	// The number of log events accepted by Log for writing.
+	EventsAccepted int64
+
+	// The number of log events that were rejected or could not be written to
+	// CloudWatch Logs.
+	EventsDropped int64
+
+	// The number of batches successfully written with PutLogEvents.
+	BatchesSent int64
+
+	// The number of failed batches that were retried.
+	BatchesRetried int64
+
+	// The number of bytes successfully written, as counted by CloudWatch Logs.
+	BytesSent int64
+
+	// The number of log streams currently being written to.
+	CurrentStreams int64
+
+	// The number of log events waiting in the queue to be batched.
+	QueuedEvents int64
+
+	// The number of PutLogEvents calls rejected with an invalid sequence
+	// token, after which the expected sequence token was adopted.
+	InvalidTokenRecoveries int64
+
+	// The number of PutLogEvents calls rejected because CloudWatch Logs had
+	// already accepted the batch.
+	DuplicateBatches int64
+
+	// The number of log streams replaced after failing QuarantineAfter
+	// consecutive writes.
+	StreamsQuarantined int64
+}
+
+// stats holds the counters behind Stats. Its fields are only accessed
+// atomically.
+type stats struct {
+	eventsAccepted int64
+	eventsDropped  int64
+	batchesSent    int64
+	batchesRetried int64
+	bytesSent      int64
+	currentStreams int64
+
+	invalidTokenRecoveries int64
+	duplicateBatches       int64
+	streamsQuarantined     int64
+}
+
+func (s *stats) snapshot() Stats {
+	return Stats{
+		EventsAccepted: atomic.LoadInt64(&s.eventsAccepted),
+		EventsDropped:  atomic.LoadInt64(&s.eventsDropped),
+		BatchesSent:    atomic.LoadInt64(&s.batchesSent),
+		BatchesRetried: atomic.LoadInt64(&s.batchesRetried),
+		BytesSent:      atomic.LoadInt64(&s.bytesSent),
+		CurrentStreams: atomic.LoadInt64(&s.currentStreams),
+
+		InvalidTokenRecoveries: atomic.LoadInt64(&s.invalidTokenRecoveries),
+		DuplicateBatches:       atomic.LoadInt64(&s.duplicateBatches),
+		StreamsQuarantined:     atomic.LoadInt64(&s.streamsQuarantined),
+	}
+}
+
+// Stats returns a snapshot of the Logger's counters.
+//
+// This method is safe for concurrent access by multiple goroutines.
+func (lg *Logger) Stats() Stats {
+	s := lg.stats.snapshot()
+	s.QueuedEvents = int64(len(lg.batcher.input))
+	return s
+}
+
+// Pending returns the approximate number of log events that have been accepted
+// by Log but not yet written to CloudWatch Logs or dropped, including those in
+// batches being written or waiting to be retried. It is cheap enough to poll
+// frequently.
+//
+// This method is safe for concurrent access by multiple goroutines.
+func (lg *Logger) Pending() int {
+	return lg.pending.count()
+}
+
+// An Observer is notified of a Logger's activity, for example to record
+// metrics. Its methods may be called concurrently from multiple goroutines,
+// and must not block.
+type Observer interface {
+	// LogEventsAccepted is called when n log events are accepted for writing.
+	LogEventsAccepted(n int)
+
+	// PutLogEvents is called after every PutLogEvents call with the number of
+	// log events and bytes in the batch, how long the call took, and the error
+	// it returned, if any.
+	PutLogEvents(events, bytes int, d time.Duration, err error)
+}
+
+type noopObserver struct{}
+
+func (noopObserver) LogEventsAccepted(int)                       {}
+func (noopObserver) PutLogEvents(int, int, time.Duration, error) {}
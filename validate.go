@@ -0,0 +1,31 @@
+package cwlogger
+
+import (
+	"time"
+)
+
+const (
+	// maxEventAge is the maximum age of a log event accepted by PutLogEvents.
+	maxEventAge = 14 * 24 * time.Hour
+
+	// defaultMaxFutureSkew is how far in the future a log event accepted by
+	// PutLogEvents may be.
+	defaultMaxFutureSkew = 2 * time.Hour
+)
+
+// checkTime returns an error if CloudWatch Logs would reject a log event with
+// the given time.
+func (lg *Logger) checkTime(t time.Time) error {
+	maxAge := maxEventAge
+	if retention := time.Duration(lg.retention) * 24 * time.Hour; retention > 0 && retention < maxAge {
+		maxAge = retention
+	}
+	age := lg.clock.Now().Sub(t)
+	if age > maxAge {
+		return ErrEventTooOld
+	}
+	if -age > lg.maxFutureSkew {
+		return ErrEventTooNew
+	}
+	return nil
+}
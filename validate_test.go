@@ -0,0 +1,94 @@
+package cwlogger
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDropsEventsOlderThanRetention(t *testing.T) {
+	var messages []string
+	var reported []error
+	config := &Config{
+		LogGroupName: "test",
+		Retention:    3,
+		ErrorReporter: func(err error) {
+			reported = append(reported, err)
+		},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			var data PutLogEvents
+			parseBody(r, &data)
+			for _, event := range data.LogEvents {
+				messages = append(messages, event.Message)
+			}
+			w.Write([]byte(`{"nextSequenceToken":"1"}`))
+		}
+	})
+
+	now := time.Now()
+	logger.Log(now.Add(-48*time.Hour), "two days old")
+	logger.Log(now.Add(-4*24*time.Hour), "four days old")
+	logger.Log(now, "now")
+	logger.Close()
+
+	assert.Equal(t, []string{"two days old", "now"}, messages)
+	assert.Equal(t, []error{ErrEventTooOld}, reported)
+}
+
+func TestDropsEventsOlderThanFourteenDays(t *testing.T) {
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {})
+	defer logger.Close()
+
+	now := time.Now()
+	assert.NoError(t, logger.LogE(now.Add(-13*24*time.Hour), "thirteen days old"))
+	assert.Equal(t, ErrEventTooOld, logger.LogE(now.Add(-15*24*time.Hour), "fifteen days old"))
+}
+
+func TestDropsEventsInTheFuture(t *testing.T) {
+	var messages []string
+	var reported []error
+	config := &Config{
+		LogGroupName: "test",
+		ErrorReporter: func(err error) {
+			reported = append(reported, err)
+		},
+	}
+
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			var data PutLogEvents
+			parseBody(r, &data)
+			for _, event := range data.LogEvents {
+				messages = append(messages, event.Message)
+			}
+			w.Write([]byte(`{"nextSequenceToken":"1"}`))
+		}
+	})
+
+	now := time.Now()
+	logger.Log(now, "now")
+	logger.Log(now.Add(3*time.Hour), "three hours ahead")
+	logger.Log(now.Add(time.Hour), "one hour ahead")
+	logger.Close()
+
+	assert.Equal(t, []string{"now", "one hour ahead"}, messages)
+	assert.Equal(t, []error{ErrEventTooNew}, reported)
+}
+
+func TestMaxFutureSkew(t *testing.T) {
+	config := &Config{
+		LogGroupName:  "test",
+		MaxFutureSkew: time.Minute,
+	}
+	logger := newLoggerWithServer(config, func(w http.ResponseWriter, r *http.Request) {})
+	defer logger.Close()
+
+	now := time.Now()
+	assert.NoError(t, logger.LogE(now.Add(30*time.Second), "message"))
+	assert.Equal(t, ErrEventTooNew, logger.LogE(now.Add(2*time.Minute), "message"))
+}
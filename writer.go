@@ -0,0 +1,36 @@
+package cwlogger
+
+import (
+	"io"
+	"log"
+	"strings"
+)
+
+// Writer returns an io.Writer that enqueues each write as a log message,
+// timestamped with the time of the write. A single trailing newline is removed
+// from each message, which allows the writer to be used as the output of
+// line-oriented loggers such as the standard library's log package.
+//
+// Writes of messages that are too large fail with ErrMessageTooLarge.
+func (lg *Logger) Writer() io.Writer {
+	return logWriter{logger: lg}
+}
+
+// StdLogger returns a standard library log.Logger that writes to the Logger
+// through Writer, with each message prefixed with prefix, for example a level
+// such as "ERROR: ". The log.Logger has no flags set, as each log message is
+// already timestamped.
+func (lg *Logger) StdLogger(prefix string) *log.Logger {
+	return log.New(lg.Writer(), prefix, 0)
+}
+
+type logWriter struct {
+	logger *Logger
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	if err := w.logger.LogE(w.logger.clock.Now(), strings.TrimSuffix(string(p), "\n")); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
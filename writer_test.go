@@ -0,0 +1,66 @@
+package cwlogger
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriterWithStandardLogger(t *testing.T) {
+	var messages []string
+	var timestamps []int64
+
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			var data PutLogEvents
+			parseBody(r, &data)
+			for _, event := range data.LogEvents {
+				messages = append(messages, event.Message)
+				timestamps = append(timestamps, event.Timestamp)
+			}
+			w.Write([]byte(`{"nextSequenceToken":"1"}`))
+		}
+	})
+
+	start := time.Now().UnixNano() / int64(time.Millisecond)
+	std := log.New(logger.Writer(), "app: ", 0)
+	std.Print("hello world")
+	logger.Close()
+
+	assert.Equal(t, []string{"app: hello world"}, messages)
+	assert.True(t, timestamps[0] >= start)
+}
+
+func TestStdLogger(t *testing.T) {
+	var messages []string
+
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {
+		if action(r) == "PutLogEvents" {
+			var data PutLogEvents
+			parseBody(r, &data)
+			for _, event := range data.LogEvents {
+				messages = append(messages, event.Message)
+			}
+		}
+	})
+
+	logger.StdLogger("INFO: ").Printf("listening on %s", ":8080")
+	logger.StdLogger("ERROR: ").Println("shutting down")
+	logger.Close()
+
+	assert.Equal(t, []string{"INFO: listening on :8080", "ERROR: shutting down"}, messages)
+}
+
+func TestWriterRejectsOversizedMessages(t *testing.T) {
+	logger := newLoggerWithServer(defaultConfig, func(w http.ResponseWriter, r *http.Request) {})
+
+	n, err := logger.Writer().Write([]byte(strings.Repeat(".", maxBatchByteSize)))
+	logger.Close()
+
+	assert.Equal(t, 0, n)
+	assert.Equal(t, ErrMessageTooLarge, err)
+}